@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -14,6 +16,7 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 var (
@@ -21,6 +24,8 @@ var (
 	numChats        = flag.Int("chats", 5, "number of concurrent chats")
 	numConnsPerChat = flag.Int("conns", 3, "number of connections per chat")
 	duration        = flag.Duration("duration", 30*time.Second, "duration of the simulation")
+	codec           = flag.String("codec", "json", "wire format: json or msgpack")
+	batch           = flag.String("batch", "", "opt into batched frames: lines or envelope")
 	totalSent       int64
 	totalReceived   int64
 	startTime       time.Time
@@ -38,6 +43,13 @@ func main() {
 	flag.Parse()
 	log.SetFlags(0)
 
+	if *codec != "json" && *codec != "msgpack" {
+		log.Fatalf("Unknown codec %q, want json or msgpack", *codec)
+	}
+	if *batch != "" && *batch != "lines" && *batch != "envelope" {
+		log.Fatalf("Unknown batch mode %q, want lines or envelope", *batch)
+	}
+
 	startTime = time.Now()
 
 	var wg sync.WaitGroup
@@ -84,9 +96,14 @@ func runChat(id int, wg *sync.WaitGroup, done chan struct{}) {
 
 func runConnection(chatID, connID int, roomName string, done chan struct{}) {
 	u := url.URL{Scheme: "ws", Host: *addr, Path: "/ws"}
+	if *batch != "" {
+		u.RawQuery = url.Values{"batch": {*batch}}.Encode()
+	}
 	log.Printf("Chat %d, Conn %d connecting to %s", chatID, connID, u.String())
 
-	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{"chat.v1." + *codec}
+	c, _, err := dialer.Dial(u.String(), nil)
 	if err != nil {
 		log.Printf("Chat %d, Conn %d dial error: %v", chatID, connID, err)
 		return
@@ -122,12 +139,40 @@ func receiveMessages(chatID, connID int, c *websocket.Conn, done chan struct{})
 				log.Printf("Chat %d, Conn %d read error: %v", chatID, connID, err)
 				return
 			}
-			atomic.AddInt64(&totalReceived, 1)
+			if *codec == "msgpack" {
+				var frame map[string]interface{}
+				if err := msgpack.Unmarshal(message, &frame); err != nil {
+					log.Printf("Chat %d, Conn %d decode error: %v", chatID, connID, err)
+					continue
+				}
+				atomic.AddInt64(&totalReceived, frameCount(frame))
+				log.Printf("Chat %d, Conn %d received: %v", chatID, connID, frame)
+				continue
+			}
+			switch *batch {
+			case "lines":
+				atomic.AddInt64(&totalReceived, int64(bytes.Count(message, []byte("\n"))+1))
+			case "envelope":
+				var frame map[string]interface{}
+				json.Unmarshal(message, &frame)
+				atomic.AddInt64(&totalReceived, frameCount(frame))
+			default:
+				atomic.AddInt64(&totalReceived, 1)
+			}
 			log.Printf("Chat %d, Conn %d received: %s", chatID, connID, message)
 		}
 	}
 }
 
+// frameCount counts the frames carried by a message, looking inside batch
+// envelopes.
+func frameCount(frame map[string]interface{}) int64 {
+	if frames, ok := frame["frames"].([]interface{}); ok && frame["type"] == "batch" {
+		return int64(len(frames))
+	}
+	return 1
+}
+
 func sendMessage(chatID, connID int, c *websocket.Conn, roomName string) {
 	message := Message{
 		Type:      "chat",
@@ -136,7 +181,7 @@ func sendMessage(chatID, connID int, c *websocket.Conn, roomName string) {
 		Timestamp: time.Now(),
 		Room:      roomName,
 	}
-	err := c.WriteJSON(message)
+	err := writeFrame(c, message)
 	if err != nil {
 		log.Printf("Chat %d, Conn %d write error: %v", chatID, connID, err)
 		return
@@ -149,12 +194,25 @@ func joinRoom(c *websocket.Conn, roomName string) {
 		Type: "join",
 		Room: roomName,
 	}
-	err := c.WriteJSON(joinMessage)
+	err := writeFrame(c, joinMessage)
 	if err != nil {
 		log.Println("join room:", err)
 	}
 }
 
+func writeFrame(c *websocket.Conn, v interface{}) error {
+	if *codec != "msgpack" {
+		return c.WriteJSON(v)
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.BinaryMessage, buf.Bytes())
+}
+
 func printFinalStats(duration time.Duration) {
 	sent := atomic.LoadInt64(&totalSent)
 	received := atomic.LoadInt64(&totalReceived)
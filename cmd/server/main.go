@@ -1,34 +1,257 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"chat/internal/backplane"
+	"chat/internal/cluster"
 	"chat/internal/config"
+	"chat/internal/filter"
+	"chat/internal/grpcapi"
+	"chat/internal/logging"
 	"chat/internal/server"
+	"chat/internal/tracing"
+	"chat/internal/webhook"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
-	log.Println("Starting chat application")
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(err)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("Failed to print configuration", err)
+		}
+		return
+	}
 
-	cfg, err := config.Load()
+	logger, err := logging.New(os.Stderr, logging.Options{
+		Level:      cfg.LogLevel,
+		Format:     cfg.LogFormat,
+		LogContent: cfg.LogContent,
+	})
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to set up logging", err)
+	}
+	slog.SetDefault(logger)
+	slog.Info("Starting chat application")
+
+	if cfg.OTLPEndpoint != "" {
+		shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+			ServiceName: "chat",
+			Endpoint:    cfg.OTLPEndpoint,
+			Insecure:    cfg.OTLPInsecure,
+			SampleRatio: cfg.TraceSampleRatio,
+		})
+		if err != nil {
+			fatal("Failed to set up tracing", err)
+		}
+		defer shutdown(context.Background())
+		slog.Info("Exporting traces", "endpoint", cfg.OTLPEndpoint)
 	}
 
-	s := server.NewServer(cfg)
+	filters, err := messageFilters(cfg)
+	if err != nil {
+		fatal("Failed to set up message filters", err)
+	}
 
-	fs := http.FileServer(http.Dir("./web/static"))
+	opts := []server.Option{server.WithMessageFilters(filters...)}
+	if cfg.WebhookQueueDir != "" {
+		queue, err := webhook.NewDirQueue(cfg.WebhookQueueDir, cfg.WebhookQueueKey)
+		if err != nil {
+			fatal("Failed to open webhook queue", err)
+		}
+		opts = append(opts, server.WithWebhookQueue(queue))
+	}
+
+	if cfg.RedisURL != "" {
+		redisOpts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			fatal("Invalid redis-url", err)
+		}
+		bp := backplane.NewRedis(redis.NewClient(redisOpts), "")
+		defer bp.Close()
+		opts = append(opts, server.WithBackplane(bp))
+		slog.Info("Using Redis backplane", "addr", redisOpts.Addr)
+	}
+
+	if cfg.ClusterPeers != "" {
+		peers, err := cluster.ParsePeers(cfg.ClusterPeers)
+		if err != nil {
+			fatal("Invalid cluster-peers", err)
+		}
+		c, err := cluster.New(cluster.Options{
+			Self:      cfg.NodeID,
+			Peers:     peers,
+			Secret:    cfg.ClusterSecret,
+			Heartbeat: cfg.ClusterHeartbeat,
+		})
+		if err != nil {
+			fatal("Failed to set up cluster", err)
+		}
+		opts = append(opts, server.WithCluster(c))
+		slog.Info("Joining cluster", "node", cfg.NodeID, "peers", len(peers))
+	}
+
+	s := server.NewServer(cfg, opts...)
+
+	fs := http.FileServer(http.Dir(cfg.StaticDir))
 	s.Router().PathPrefix("/static/").Handler(http.StripPrefix("/static/", fs))
-	log.Println("Static file server set up")
 
 	s.Router().HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		log.Println("Serving index.html")
-		http.ServeFile(w, r, "./web/templates/index.html")
+		http.ServeFile(w, r, cfg.IndexFile)
 	})
 
-	log.Printf("Starting server on %s", cfg.Address)
-	if err := http.ListenAndServe(cfg.Address, s.Router()); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	// Listeners other than HTTP, closed once the drain period is over.
+	var listeners []net.Listener
+
+	if cfg.TCPAddress != "" {
+		l, err := net.Listen("tcp", cfg.TCPAddress)
+		if err != nil {
+			fatal("Failed to listen for TCP clients", err)
+		}
+		listeners = append(listeners, l)
+		slog.Info("Accepting TCP clients", "addr", cfg.TCPAddress)
+		go func() {
+			if err := s.ServeTCP(l); err != nil {
+				fatal("TCP gateway failed", err)
+			}
+		}()
+	}
+
+	if cfg.IRCAddress != "" {
+		l, err := net.Listen("tcp", cfg.IRCAddress)
+		if err != nil {
+			fatal("Failed to listen for IRC clients", err)
+		}
+		listeners = append(listeners, l)
+		slog.Info("Accepting IRC clients", "addr", cfg.IRCAddress)
+		go func() {
+			if err := s.ServeIRC(l); err != nil {
+				fatal("IRC gateway failed", err)
+			}
+		}()
+	}
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCAddress != "" {
+		l, err := net.Listen("tcp", cfg.GRPCAddress)
+		if err != nil {
+			fatal("Failed to listen for gRPC clients", err)
+		}
+		var grpcOpts []grpc.ServerOption
+		if cfg.GRPCTLSCertFile != "" {
+			creds, err := credentials.NewServerTLSFromFile(cfg.GRPCTLSCertFile, cfg.GRPCTLSKeyFile)
+			if err != nil {
+				fatal("Failed to load gRPC TLS certificate", err)
+			}
+			grpcOpts = append(grpcOpts, grpc.Creds(creds))
+		}
+		grpcServer = grpcapi.NewServer(s, grpcOpts...)
+		slog.Info("Accepting gRPC clients", "addr", cfg.GRPCAddress, "tls", cfg.GRPCTLSCertFile != "")
+		go func() {
+			if err := grpcServer.Serve(l); err != nil {
+				fatal("gRPC server failed", err)
+			}
+		}()
+	}
+
+	httpServer := &http.Server{
+		Addr:              cfg.Address,
+		Handler:           s.Router(),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+	}
+	go func() {
+		slog.Info("Starting server", "addr", cfg.Address, "tls", cfg.TLSCertFile != "")
+		var err error
+		if cfg.TLSCertFile != "" {
+			err = httpServer.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Failed to start server", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	// Fail readiness first and keep serving for the drain period, so load
+	// balancers stop routing new clients here before the listener closes.
+	slog.Info("Draining", "period", cfg.DrainPeriod)
+	s.Drain()
+	time.Sleep(cfg.DrainPeriod)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	for _, l := range listeners {
+		l.Close()
+	}
+	grpcStopped := make(chan struct{})
+	go func() {
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+		close(grpcStopped)
+	}()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down server", "error", err)
+	}
+	// Chat streams can outlive the timeout; cut them off with it like HTTP.
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+	}
+	s.Close()
+	slog.Info("Server stopped")
+}
+
+// fatal logs err and exits. It is only used during startup and by the
+// listeners' goroutines, where there is nothing left to clean up.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func messageFilters(cfg *config.Config) ([]filter.MessageFilter, error) {
+	var filters []filter.MessageFilter
+	if cfg.MaxMessageLength > 0 {
+		filters = append(filters, filter.MaxLength(cfg.MaxMessageLength))
+	}
+	if cfg.BannedWordsFile != "" {
+		bannedWords, err := filter.LoadBannedWords(cfg.BannedWordsFile)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, bannedWords)
+	}
+	if cfg.BlockLinks {
+		filters = append(filters, filter.BlockLinks())
 	}
+	return filters, nil
 }
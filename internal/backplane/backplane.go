@@ -0,0 +1,82 @@
+package backplane
+
+import (
+	"context"
+	"sync"
+)
+
+// Handler receives the payloads published to a room by any node, including
+// the subscriber's own node.
+type Handler func(payload []byte)
+
+// Backplane fans room traffic out between server nodes. Payloads are opaque;
+// ordering is only guaranteed per publisher.
+type Backplane interface {
+	Publish(ctx context.Context, room string, payload []byte) error
+	// Subscribe registers handler for room until the returned function is
+	// called. Handlers run on the backplane's delivery goroutine, so they
+	// must not block or call back into the backplane.
+	Subscribe(room string, handler Handler) (unsubscribe func(), err error)
+	Close() error
+}
+
+// Memory is a Backplane for nodes that share a process, such as tests or a
+// single binary running several servers.
+type Memory struct {
+	mu       sync.RWMutex
+	handlers map[string]map[uint64]Handler
+	next     uint64
+}
+
+func NewMemory() *Memory {
+	return &Memory{handlers: make(map[string]map[uint64]Handler)}
+}
+
+func (m *Memory) Publish(ctx context.Context, room string, payload []byte) error {
+	m.mu.RLock()
+	handlers := make([]Handler, 0, len(m.handlers[room]))
+	for _, handler := range m.handlers[room] {
+		handlers = append(handlers, handler)
+	}
+	m.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(room string, handler Handler) (func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.next++
+	id := m.next
+	if m.handlers[room] == nil {
+		m.handlers[room] = make(map[uint64]Handler)
+	}
+	m.handlers[room][id] = handler
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			delete(m.handlers[room], id)
+			if len(m.handlers[room]) == 0 {
+				delete(m.handlers, room)
+			}
+		})
+	}, nil
+}
+
+// Subscribers reports how many handlers are registered for room.
+func (m *Memory) Subscribers(room string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.handlers[room])
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package backplane
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultRedisPrefix = "chat:room:"
+
+// Redis is a Backplane over Redis pub/sub. Every room maps to one channel;
+// the node holds a single subscriber connection and only subscribes to the
+// channels of rooms that currently have local handlers.
+type Redis struct {
+	client redis.UniversalClient
+	prefix string
+	pubsub *redis.PubSub
+
+	mu       sync.Mutex
+	handlers map[string]map[uint64]Handler
+	next     uint64
+
+	done chan struct{}
+}
+
+func NewRedis(client redis.UniversalClient, prefix string) *Redis {
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	r := &Redis{
+		client:   client,
+		prefix:   prefix,
+		pubsub:   client.Subscribe(context.Background()),
+		handlers: make(map[string]map[uint64]Handler),
+		done:     make(chan struct{}),
+	}
+	go r.dispatch()
+	return r
+}
+
+func (r *Redis) Publish(ctx context.Context, room string, payload []byte) error {
+	return r.client.Publish(ctx, r.prefix+room, payload).Err()
+}
+
+func (r *Redis) Subscribe(room string, handler Handler) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.handlers[room]) == 0 {
+		if err := r.pubsub.Subscribe(context.Background(), r.prefix+room); err != nil {
+			return nil, err
+		}
+		r.handlers[room] = make(map[uint64]Handler)
+	}
+	r.next++
+	id := r.next
+	r.handlers[room][id] = handler
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.unsubscribe(room, id)
+		})
+	}, nil
+}
+
+func (r *Redis) unsubscribe(room string, id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.handlers[room], id)
+	if len(r.handlers[room]) > 0 {
+		return
+	}
+	delete(r.handlers, room)
+	r.pubsub.Unsubscribe(context.Background(), r.prefix+room)
+}
+
+func (r *Redis) dispatch() {
+	defer close(r.done)
+	for msg := range r.pubsub.Channel() {
+		room := strings.TrimPrefix(msg.Channel, r.prefix)
+
+		r.mu.Lock()
+		handlers := make([]Handler, 0, len(r.handlers[room]))
+		for _, handler := range r.handlers[room] {
+			handlers = append(handlers, handler)
+		}
+		r.mu.Unlock()
+
+		payload := []byte(msg.Payload)
+		for _, handler := range handlers {
+			handler(payload)
+		}
+	}
+}
+
+// Ping checks that the Redis server is reachable.
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Close stops the subscriber. The client passed to NewRedis is left open.
+func (r *Redis) Close() error {
+	err := r.pubsub.Close()
+	<-r.done
+	return err
+}
@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	"chat/internal/chat"
+)
+
+const (
+	EventMessage = "message"
+	EventMention = "mention"
+	EventJoin    = "join"
+	EventLeave   = "leave"
+)
+
+// Event is a room event delivered to a bot. Message is set for message and
+// mention events; Name is the member that joined or left.
+type Event struct {
+	Type    string
+	Room    string
+	Name    string
+	Message *chat.Message
+	Time    time.Time
+}
+
+// API is the set of actions a bot can take. Bots act as regular room members,
+// so messages they send go through the same filters as everyone else's.
+type API interface {
+	Join(room string) error
+	Leave(room string)
+	Send(room, content string) (string, error)
+	React(room, messageID, emoji string) error
+	Kick(room, name, reason string) error
+}
+
+// Bot is an in-process chat member. Init is called once when the bot is
+// registered; Handle is then called for every event in the bot's rooms, one
+// at a time.
+type Bot interface {
+	Name() string
+	Init(api API) error
+	Handle(ctx context.Context, ev Event) error
+}
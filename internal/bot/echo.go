@@ -0,0 +1,40 @@
+package bot
+
+import (
+	"context"
+	"strings"
+)
+
+// Echo repeats every message that mentions it.
+type Echo struct {
+	name  string
+	rooms []string
+	api   API
+}
+
+func NewEcho(name string, rooms ...string) *Echo {
+	return &Echo{name: name, rooms: rooms}
+}
+
+func (e *Echo) Name() string {
+	return e.name
+}
+
+func (e *Echo) Init(api API) error {
+	e.api = api
+	for _, room := range e.rooms {
+		if err := api.Join(room); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Echo) Handle(ctx context.Context, ev Event) error {
+	if ev.Type != EventMention {
+		return nil
+	}
+	content := strings.TrimSpace(strings.ReplaceAll(ev.Message.Content, "@"+e.name, ""))
+	_, err := e.api.Send(ev.Room, ev.Message.Sender+": "+content)
+	return err
+}
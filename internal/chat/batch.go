@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Batch modes a client can opt into. With BatchLines, frames queued together
+// are written as one message of newline-separated JSON documents; with
+// BatchEnvelope they are wrapped in a {"type":"batch","frames":[...]} frame.
+// Connections with a binary codec always use the envelope.
+const (
+	BatchLines    = "lines"
+	BatchEnvelope = "envelope"
+
+	EventBatch = "batch"
+)
+
+const (
+	defaultBatchMaxMessages = 64
+
+	// maxPreparedBatches is how many batches a frame remembers having
+	// started. Members that fall out of step with the rest of the room
+	// start batches nobody else will reuse, so the list is kept short.
+	maxPreparedBatches = 4
+)
+
+// BatchOptions control write coalescing. MaxMessages caps how many queued
+// frames go into one message. MaxDelay is how long the write pump may hold a
+// frame back waiting for more; zero only coalesces what is already queued.
+type BatchOptions struct {
+	Mode        string
+	MaxMessages int
+	MaxDelay    time.Duration
+}
+
+func ValidBatchMode(mode string) bool {
+	return mode == BatchLines || mode == BatchEnvelope
+}
+
+var (
+	batchOpen  = []byte(`{"type":"` + EventBatch + `","frames":[`)
+	batchClose = []byte(`]}`)
+)
+
+// encodeBatch joins frames into a single message for codec.
+func encodeBatch(frames []*Frame, mode string, codec Codec) ([]byte, error) {
+	var buf bytes.Buffer
+	if mode == BatchLines && codec == JSONCodec {
+		for i, frame := range frames {
+			if i > 0 {
+				buf.WriteByte('\n')
+			}
+			buf.Write(frame.Payload())
+		}
+		return buf.Bytes(), nil
+	}
+
+	buf.Write(batchOpen)
+	for i, frame := range frames {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(frame.Payload())
+	}
+	buf.Write(batchClose)
+	return codec.Encode(buf.Bytes())
+}
+
+// preparedBatch is a batch of broadcast frames written as a prepared message.
+// Members of a room usually drain the same run of broadcasts from their send
+// queues, so a batch is kept on its first frame for the others to reuse.
+type preparedBatch struct {
+	frames []*Frame
+	mode   string
+	codec  string
+	pm     *websocket.PreparedMessage
+	data   []byte
+}
+
+func (b *preparedBatch) matches(frames []*Frame, mode string, codec Codec) bool {
+	if b.mode != mode || b.codec != codec.Name() || len(b.frames) != len(frames) {
+		return false
+	}
+	for i, frame := range frames {
+		if b.frames[i] != frame {
+			return false
+		}
+	}
+	return true
+}
+
+// prepareBatch returns frames batched for codec as a prepared message, along
+// with the encoded batch it wraps.
+func prepareBatch(frames []*Frame, mode string, codec Codec) (*websocket.PreparedMessage, []byte, error) {
+	first := frames[0]
+	first.mu.Lock()
+	defer first.mu.Unlock()
+
+	for _, b := range first.batches {
+		if b.matches(frames, mode, codec) {
+			return b.pm, b.data, nil
+		}
+	}
+
+	data, err := encodeBatch(frames, mode, codec)
+	if err != nil {
+		return nil, nil, err
+	}
+	messageType := websocket.TextMessage
+	if codec.Binary() {
+		messageType = websocket.BinaryMessage
+	}
+	pm, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := &preparedBatch{frames: frames, mode: mode, codec: codec.Name(), pm: pm, data: data}
+	if len(first.batches) == maxPreparedBatches {
+		first.batches = first.batches[1:]
+	}
+	first.batches = append(first.batches, b)
+	return pm, data, nil
+}
@@ -0,0 +1,155 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// WebSocket subprotocols naming the wire format of a connection. Clients that
+// do not ask for one get JSON.
+const (
+	ProtocolJSON    = "chat.v1.json"
+	ProtocolMsgpack = "chat.v1.msgpack"
+)
+
+// Codec converts frames between the JSON used inside the server and a
+// connection's wire format. Encode and Decode must be safe for concurrent use.
+type Codec interface {
+	Name() string
+	Binary() bool
+	Encode(frame []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+var codecs = []Codec{JSONCodec, MsgpackCodec}
+
+// Protocols lists the subprotocol names of every supported codec.
+func Protocols() []string {
+	names := make([]string, 0, len(codecs))
+	for _, codec := range codecs {
+		names = append(names, codec.Name())
+	}
+	return names
+}
+
+func CodecByName(name string) (Codec, bool) {
+	for _, codec := range codecs {
+		if codec.Name() == name {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// NegotiateCodec picks the first of the offered subprotocols that names a
+// supported codec, honouring the client's order of preference.
+func NegotiateCodec(offered []string) (Codec, bool) {
+	for _, name := range offered {
+		if codec, ok := CodecByName(name); ok {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return ProtocolJSON }
+
+func (jsonCodec) Binary() bool { return false }
+
+func (jsonCodec) Encode(frame []byte) ([]byte, error) { return frame, nil }
+
+func (jsonCodec) Decode(data []byte) ([]byte, error) { return data, nil }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return ProtocolMsgpack }
+
+func (msgpackCodec) Binary() bool { return true }
+
+func (msgpackCodec) Encode(frame []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(frame))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(fromJSONNumbers(v))
+}
+
+func (msgpackCodec) Decode(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := msgpack.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	v, err := toJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// fromJSONNumbers replaces json.Number values with integers where they fit so
+// sequence numbers and counters reach MessagePack clients as integers.
+func fromJSONNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = fromJSONNumbers(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = fromJSONNumbers(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// toJSONValue rejects decoded MessagePack values that have no JSON
+// representation, such as maps with non-string keys.
+func toJSONValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			converted, err := toJSONValue(value)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		return nil, fmt.Errorf("msgpack map keys must be strings")
+	case []interface{}:
+		for i, value := range v {
+			converted, err := toJSONValue(value)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	case []byte:
+		return string(v), nil
+	default:
+		return v, nil
+	}
+}
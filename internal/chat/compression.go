@@ -0,0 +1,65 @@
+package chat
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// Compression accumulates permessage-deflate statistics for every WebSocket
+// connection in the process.
+var Compression CompressionStats
+
+// CompressionStats counts the messages written with compression enabled.
+// PayloadBytes is their size before compression and WireBytes what actually
+// went out on the network, frame headers included.
+type CompressionStats struct {
+	Messages     atomic.Uint64
+	Skipped      atomic.Uint64
+	PayloadBytes atomic.Uint64
+	WireBytes    atomic.Uint64
+}
+
+type CompressionSnapshot struct {
+	Messages     uint64  `json:"messages"`
+	Skipped      uint64  `json:"skipped"`
+	PayloadBytes uint64  `json:"payload_bytes"`
+	WireBytes    uint64  `json:"wire_bytes"`
+	Ratio        float64 `json:"ratio"`
+}
+
+// Snapshot returns the current counters. Ratio is wire bytes over payload
+// bytes, so smaller is better; it is zero until something was compressed.
+func (s *CompressionStats) Snapshot() CompressionSnapshot {
+	snapshot := CompressionSnapshot{
+		Messages:     s.Messages.Load(),
+		Skipped:      s.Skipped.Load(),
+		PayloadBytes: s.PayloadBytes.Load(),
+		WireBytes:    s.WireBytes.Load(),
+	}
+	if snapshot.PayloadBytes > 0 {
+		snapshot.Ratio = float64(snapshot.WireBytes) / float64(snapshot.PayloadBytes)
+	}
+	return snapshot
+}
+
+// CountingConn is a net.Conn that counts the bytes written through it. The
+// WebSocket transport uses it to see how large a compressed message was on
+// the wire.
+type CountingConn struct {
+	net.Conn
+	written atomic.Uint64
+}
+
+func NewCountingConn(conn net.Conn) *CountingConn {
+	return &CountingConn{Conn: conn}
+}
+
+func (c *CountingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(uint64(n))
+	return n, err
+}
+
+func (c *CountingConn) Written() uint64 {
+	return c.written.Load()
+}
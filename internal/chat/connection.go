@@ -1,67 +1,349 @@
 package chat
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"chat/internal/logging"
+	"chat/internal/metrics"
+	"chat/internal/tracing"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Connection struct {
-	conn          *websocket.Conn
-	Rooms         map[string]*Room
-	send          chan []byte
-	HandleMessage func(message []byte)
+	id            string
+	remoteAddr    string
+	connectedAt   time.Time
+	logger        *slog.Logger
+	transport     Transport
+	codec         Codec
+	batch         BatchOptions
+	send          chan *Frame
+	done          chan struct{}
+	stopped       chan struct{}
+	closeOnce     sync.Once
+	HandleMessage func(ctx context.Context, frame *Inbound)
 }
 
 func NewConnection(conn *websocket.Conn) *Connection {
+	return NewWebSocketConnection(conn, WebSocketOptions{})
+}
+
+// NewWebSocketConnection wraps a WebSocket, speaking the codec named by the
+// subprotocol negotiated during the upgrade.
+func NewWebSocketConnection(conn *websocket.Conn, opts WebSocketOptions) *Connection {
+	codec, ok := CodecByName(conn.Subprotocol())
+	if !ok {
+		codec = JSONCodec
+	}
+	opts.Binary = codec.Binary()
+	c := NewTransportConnection(NewWebSocketTransport(conn, opts))
+	c.codec = codec
+	return c
+}
+
+func NewTransportConnection(transport Transport) *Connection {
+	id := NewMessageID()
 	return &Connection{
-		conn:          conn,
-		Rooms:         make(map[string]*Room),
-		send:          make(chan []byte, 256),
-		HandleMessage: func(message []byte) {},
+		id:            id,
+		connectedAt:   time.Now(),
+		logger:        slog.Default().With(logging.KeyConn, id),
+		transport:     transport,
+		codec:         JSONCodec,
+		send:          make(chan *Frame, 256),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+		HandleMessage: func(ctx context.Context, frame *Inbound) {},
+	}
+}
+
+// NewLocalConnection returns a connection that is not backed by a transport.
+// In-process members such as bots read their frames from Messages.
+func NewLocalConnection() *Connection {
+	return NewTransportConnection(nil)
+}
+
+// ID identifies the connection in logs for as long as it is open.
+func (c *Connection) ID() string {
+	return c.id
+}
+
+func (c *Connection) RemoteAddr() string {
+	return c.remoteAddr
+}
+
+// SetRemoteAddr records the client's address. It must be called before the
+// pumps start.
+func (c *Connection) SetRemoteAddr(addr string) {
+	c.remoteAddr = addr
+}
+
+func (c *Connection) ConnectedAt() time.Time {
+	return c.connectedAt
+}
+
+// QueueDepth returns the number of frames waiting for the write pump.
+func (c *Connection) QueueDepth() int {
+	return len(c.send)
+}
+
+func (c *Connection) Logger() *slog.Logger {
+	return c.logger
+}
+
+// SetLogger replaces the connection's logger, which should already carry the
+// connection ID. It must be called before the pumps start.
+func (c *Connection) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
+func (c *Connection) Messages() <-chan *Frame {
+	return c.send
+}
+
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+// Stopped is closed once the write pump has returned and will no longer touch
+// the transport.
+func (c *Connection) Stopped() <-chan struct{} {
+	return c.stopped
+}
+
+func (c *Connection) Codec() Codec {
+	return c.codec
+}
+
+// EnableBatching makes the write pump coalesce queued frames into a single
+// message. It must be called before WritePump starts.
+func (c *Connection) EnableBatching(opts BatchOptions) {
+	if opts.MaxMessages <= 0 {
+		opts.MaxMessages = defaultBatchMaxMessages
 	}
+	c.batch = opts
+}
+
+// Send queues a JSON message for the write pump without blocking. It reports
+// false when the queue is full or the connection has been closed.
+func (c *Connection) Send(message []byte) bool {
+	return c.SendFrame(NewFrame(message))
+}
+
+// SendFrame is Send for a frame that may be shared with other connections.
+func (c *Connection) SendFrame(frame *Frame) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- frame:
+		metrics.SendQueueDepth.Observe(float64(len(c.send)))
+		return true
+	default:
+		return false
+	}
+}
+
+// Close asks the write pump to shut the transport down. It is safe to call
+// more than once and from any goroutine.
+func (c *Connection) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
 }
 
 func (c *Connection) ReadPump(onClose func()) {
 	defer func() {
 		onClose()
-		c.conn.Close()
+		c.transport.Close()
 	}()
 
 	for {
-		_, message, err := c.conn.ReadMessage()
+		message, err := c.transport.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
+			if !errors.Is(err, io.EOF) {
+				c.logger.Debug("Error reading from transport", "error", err)
 			}
 			break
 		}
-		c.HandleMessage(message)
+		message, err = c.codec.Decode(message)
+		if err != nil {
+			c.logger.Warn("Error decoding frame", "codec", c.codec.Name(), "error", err)
+			continue
+		}
+		c.handle(message)
 	}
 }
 
+// handle decodes one client frame and runs HandleMessage for it inside a
+// span. A frame that carries a traceparent field is linked to the client's
+// trace.
+func (c *Connection) handle(message []byte) {
+	var frame Inbound
+	if err := json.Unmarshal(message, &frame); err != nil {
+		c.logger.Warn("Error unmarshaling message", "error", err)
+		return
+	}
+
+	client := tracing.WithTraceParent(context.Background(), frame.TraceParent)
+	ctx, span := tracer.Start(context.Background(), "chat.receive", append(tracing.Link(client),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(AttrConn.String(c.id), AttrFrameType.String(frame.Type)))...)
+	defer span.End()
+
+	c.HandleMessage(ctx, &frame)
+}
+
 func (c *Connection) WritePump() {
 	defer func() {
-		c.conn.Close()
+		c.transport.Close()
+		close(c.stopped)
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.send:
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
+		case <-c.done:
+			return
+		case frame := <-c.send:
+			var err error
+			if c.batch.Mode == "" {
+				err = c.writeFrame(frame)
+			} else {
+				err = c.writeFrames(c.collect(frame))
 			}
-
-			w, err := c.conn.NextWriter(websocket.TextMessage)
 			if err != nil {
 				return
 			}
-			w.Write(message)
+		}
+	}
+}
 
-			if err := w.Close(); err != nil {
-				return
+// writeFrame writes a single frame. Frames that cannot be encoded are logged
+// and skipped; only transport errors are returned.
+func (c *Connection) writeFrame(frame *Frame) (err error) {
+	defer c.traceDelivery(frame)(&err)
+
+	message, err := frame.Encode(c.codec)
+	if err != nil {
+		c.logger.Error("Error encoding frame", "codec", c.codec.Name(), "error", err)
+		return nil
+	}
+	if w, ok := c.transport.(FrameWriter); ok && frame.Broadcast() {
+		err = w.WriteFrame(frame, c.codec)
+	} else {
+		err = c.transport.WriteMessage(message)
+	}
+	if err == nil {
+		countSent(frame)
+	}
+	return err
+}
+
+// writeFrames writes frames as one batched message, prepared once for every
+// member that batched the same broadcasts.
+func (c *Connection) writeFrames(frames []*Frame) (err error) {
+	if len(frames) == 1 {
+		return c.writeFrame(frames[0])
+	}
+	defer c.traceDelivery(frames...)(&err)
+
+	if w, ok := c.transport.(FrameWriter); ok && broadcasts(frames) {
+		err = w.WriteBatch(frames, c.batch.Mode, c.codec)
+	} else {
+		message, encodeErr := encodeBatch(frames, c.batch.Mode, c.codec)
+		if encodeErr != nil {
+			c.logger.Error("Error encoding batch", "codec", c.codec.Name(), "error", encodeErr)
+			return nil
+		}
+		err = c.transport.WriteMessage(message)
+	}
+	if err == nil {
+		for _, frame := range frames {
+			countSent(frame)
+		}
+	}
+	return err
+}
+
+func broadcasts(frames []*Frame) bool {
+	for _, frame := range frames {
+		if !frame.Broadcast() {
+			return false
+		}
+	}
+	return true
+}
+
+// traceDelivery opens a span for each traced frame, starting when the frame
+// was queued so that it covers the wait in the send queue as well as the
+// write. The returned function ends the spans with the write's outcome.
+func (c *Connection) traceDelivery(frames ...*Frame) func(*error) {
+	var spans []trace.Span
+	for _, frame := range frames {
+		if !frame.span.IsSampled() {
+			continue
+		}
+		ctx := trace.ContextWithSpanContext(context.Background(), frame.span)
+		_, span := tracer.Start(ctx, "chat.deliver",
+			trace.WithTimestamp(frame.queued),
+			trace.WithAttributes(AttrConn.String(c.id), AttrFrameType.String(frame.Type())))
+		spans = append(spans, span)
+	}
+	return func(err *error) {
+		for _, span := range spans {
+			EndSpan(span, *err)
+		}
+	}
+}
+
+func countSent(frame *Frame) {
+	typ := frame.Type()
+	metrics.MessagesSent.WithLabelValues(typ).Inc()
+	if typ == EventError {
+		metrics.ErrorFrames.Inc()
+	}
+}
+
+// collect gathers the frames queued behind first, up to the batch caps.
+func (c *Connection) collect(first *Frame) []*Frame {
+	frames := []*Frame{first}
+
+	var deadline <-chan time.Time
+	if c.batch.MaxDelay > 0 {
+		timer := time.NewTimer(c.batch.MaxDelay)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for len(frames) < c.batch.MaxMessages {
+		if deadline == nil {
+			select {
+			case frame := <-c.send:
+				frames = append(frames, frame)
+			default:
+				return frames
 			}
+			continue
+		}
+
+		select {
+		case frame := <-c.send:
+			frames = append(frames, frame)
+		case <-deadline:
+			return frames
+		case <-c.done:
+			return frames
 		}
 	}
+	return frames
 }
@@ -0,0 +1,34 @@
+package chat
+
+import (
+	"encoding/json"
+	"log/slog"
+)
+
+const (
+	EventRoomUpdated = "room_updated"
+	EventRoomDeleted = "room_deleted"
+)
+
+// RoomUpdated is the data of an EventRoomUpdated frame: the room's metadata
+// after the update, plus the update itself so clients can tell what changed.
+type RoomUpdated struct {
+	RoomInfo
+	Update RoomUpdate `json:"update"`
+}
+
+// Event is a server-originated frame sent to the members of a room.
+type Event struct {
+	Type string      `json:"type"`
+	Room string      `json:"room"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+func NewEvent(eventType, roomID string, data interface{}) []byte {
+	payload, err := json.Marshal(Event{Type: eventType, Room: roomID, Data: data})
+	if err != nil {
+		slog.Error("Error marshaling event", "type", eventType, "error", err)
+		return nil
+	}
+	return payload
+}
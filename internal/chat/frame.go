@@ -0,0 +1,119 @@
+package chat
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Frame is an outbound JSON frame. A broadcast hands the same Frame to every
+// member of a room, so each wire encoding is produced at most once no matter
+// how many members share a codec.
+type Frame struct {
+	payload   []byte
+	broadcast bool
+
+	// span is the broadcast the frame belongs to, if it is traced; queued
+	// is when it was handed to the members' send queues.
+	span   trace.SpanContext
+	queued time.Time
+
+	mu       sync.Mutex
+	typ      *string
+	encoded  map[string][]byte
+	prepared map[string]*websocket.PreparedMessage
+	batches  []*preparedBatch
+}
+
+func NewFrame(payload []byte) *Frame {
+	return &Frame{payload: payload}
+}
+
+// NewBroadcastFrame returns a frame that is about to be written to many
+// connections. WebSocket transports write it as a prepared message, so
+// framing and compression happen once per codec rather than per recipient.
+func NewBroadcastFrame(payload []byte) *Frame {
+	return &Frame{payload: payload, broadcast: true}
+}
+
+// Payload returns the frame as JSON.
+func (f *Frame) Payload() []byte {
+	return f.payload
+}
+
+func (f *Frame) Broadcast() bool {
+	return f.broadcast
+}
+
+// Type returns the frame's type field, or the empty string if it has none.
+func (f *Frame) Type() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.typ == nil {
+		var header struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(f.payload, &header)
+		f.typ = &header.Type
+	}
+	return *f.typ
+}
+
+func (f *Frame) Encode(codec Codec) ([]byte, error) {
+	if codec == JSONCodec {
+		return f.payload, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.encodeLocked(codec)
+}
+
+func (f *Frame) encodeLocked(codec Codec) ([]byte, error) {
+	if data, ok := f.encoded[codec.Name()]; ok {
+		return data, nil
+	}
+	data, err := codec.Encode(f.payload)
+	if err != nil {
+		return nil, err
+	}
+	if f.encoded == nil {
+		f.encoded = make(map[string][]byte)
+	}
+	f.encoded[codec.Name()] = data
+	return data, nil
+}
+
+// Prepared returns the frame encoded for codec as a WebSocket prepared
+// message, along with the encoded payload it wraps.
+func (f *Frame) Prepared(codec Codec) (*websocket.PreparedMessage, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := f.encodeLocked(codec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pm, ok := f.prepared[codec.Name()]; ok {
+		return pm, data, nil
+	}
+
+	messageType := websocket.TextMessage
+	if codec.Binary() {
+		messageType = websocket.BinaryMessage
+	}
+	pm, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.prepared == nil {
+		f.prepared = make(map[string]*websocket.PreparedMessage)
+	}
+	f.prepared[codec.Name()] = pm
+	return pm, data, nil
+}
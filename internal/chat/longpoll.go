@@ -0,0 +1,147 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var ErrPollQueueFull = errors.New("poll queue full")
+
+// LongPollTransport buffers outbound frames until the client collects them
+// with Poll. Inbound frames arrive through Push from the paired send endpoint.
+type LongPollTransport struct {
+	inbound  chan []byte
+	closed   chan struct{}
+	once     sync.Once
+	notify   chan struct{}
+	maxQueue int
+
+	mu       sync.Mutex
+	pending  [][]byte
+	lastPoll time.Time
+	polling  int
+}
+
+func NewLongPollTransport(maxQueue int) *LongPollTransport {
+	return &LongPollTransport{
+		inbound:  make(chan []byte, 64),
+		closed:   make(chan struct{}),
+		notify:   make(chan struct{}, 1),
+		maxQueue: maxQueue,
+		lastPoll: time.Now(),
+	}
+}
+
+func (t *LongPollTransport) Push(message []byte) error {
+	t.touch()
+	select {
+	case <-t.closed:
+		return ErrTransportClosed
+	default:
+	}
+
+	select {
+	case t.inbound <- message:
+		return nil
+	case <-t.closed:
+		return ErrTransportClosed
+	}
+}
+
+func (t *LongPollTransport) ReadMessage() ([]byte, error) {
+	select {
+	case message := <-t.inbound:
+		return message, nil
+	case <-t.closed:
+		return nil, io.EOF
+	}
+}
+
+// WriteMessage queues a frame for the next poll. A client that stops polling
+// fills the queue and the connection is dropped as a slow consumer.
+func (t *LongPollTransport) WriteMessage(message []byte) error {
+	t.mu.Lock()
+	if len(t.pending) >= t.maxQueue {
+		t.mu.Unlock()
+		return ErrPollQueueFull
+	}
+	t.pending = append(t.pending, message)
+	t.mu.Unlock()
+
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Poll returns every queued frame, waiting up to wait for the first one.
+func (t *LongPollTransport) Poll(ctx context.Context, wait time.Duration) ([][]byte, error) {
+	t.mu.Lock()
+	t.polling++
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.polling--
+		t.lastPoll = time.Now()
+		t.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		if frames := t.take(); len(frames) > 0 {
+			return frames, nil
+		}
+
+		select {
+		case <-t.notify:
+		case <-timer.C:
+			return t.take(), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.closed:
+			return t.take(), ErrTransportClosed
+		}
+	}
+}
+
+// Idle reports how long ago the client last polled or sent a frame. A client
+// waiting in Poll is never idle, however short the session TTL.
+func (t *LongPollTransport) Idle() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.polling > 0 {
+		return 0
+	}
+	return time.Since(t.lastPoll)
+}
+
+func (t *LongPollTransport) Close() error {
+	t.once.Do(func() {
+		close(t.closed)
+	})
+	return nil
+}
+
+func (t *LongPollTransport) Done() <-chan struct{} {
+	return t.closed
+}
+
+func (t *LongPollTransport) take() [][]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	frames := t.pending
+	t.pending = nil
+	return frames
+}
+
+func (t *LongPollTransport) touch() {
+	t.mu.Lock()
+	t.lastPoll = time.Now()
+	t.mu.Unlock()
+}
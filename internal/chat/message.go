@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventError    = "error"
+	EventJoin     = "join"
+	EventLeave    = "leave"
+	EventReaction = "reaction"
+)
+
+// Message is a chat line as exchanged with clients. Bot is set on messages
+// posted by bots and through the HTTP ingest endpoint.
+type Message struct {
+	ID        string    `json:"id,omitempty"`
+	Seq       uint64    `json:"seq,omitempty"`
+	Type      string    `json:"type"`
+	Room      string    `json:"room"`
+	Content   string    `json:"content"`
+	Sender    string    `json:"sender,omitempty"`
+	Bot       bool      `json:"bot,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Inbound is a frame sent by a client. The connection decodes it once and
+// hands it to HandleMessage; fields a frame type does not use stay empty.
+// Topic is a pointer so that clearing the topic can be told from leaving it
+// out.
+type Inbound struct {
+	Type        string    `json:"type"`
+	Room        string    `json:"room"`
+	Content     string    `json:"content"`
+	Name        string    `json:"name"`
+	To          string    `json:"to"`
+	Topic       *string   `json:"topic"`
+	Timestamp   time.Time `json:"timestamp"`
+	TraceParent string    `json:"traceparent"`
+}
+
+func ParseMessage(data []byte) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return &msg, nil
+}
+
+func (m *Message) Marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// NewError builds an error frame addressed to a single client.
+func NewError(roomID, reason string) []byte {
+	return NewEvent(EventError, roomID, map[string]string{"reason": reason})
+}
+
+func NewMessageID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,28 +1,115 @@
 package chat
 
-import "log"
+import (
+	"log/slog"
+	"sync"
+
+	"chat/internal/logging"
+)
 
 type ChatParticipant struct {
 	Conn  *Connection
-	Rooms map[string]*Room
+	Bot   bool
+	name  string
+	rooms map[string]*Room
+	mu    sync.RWMutex
+}
+
+// MemberInfo describes a room member in join, leave and listing payloads.
+type MemberInfo struct {
+	Name string `json:"name"`
+	Bot  bool   `json:"bot,omitempty"`
 }
 
 func NewChatParticipant(conn *Connection) *ChatParticipant {
 	return &ChatParticipant{
 		Conn:  conn,
-		Rooms: make(map[string]*Room),
+		rooms: make(map[string]*Room),
 	}
 }
 
-func (cp *ChatParticipant) JoinRoom(room *Room) {
-	cp.Rooms[room.ID] = room
-	room.Join(cp)
+func (cp *ChatParticipant) Name() string {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.name
+}
+
+func (cp *ChatParticipant) SetName(name string) {
+	cp.mu.Lock()
+	cp.name = name
+	cp.mu.Unlock()
+}
+
+// Logger returns the connection's logger tagged with the participant's
+// current name.
+func (cp *ChatParticipant) Logger() *slog.Logger {
+	return cp.Conn.Logger().With(logging.KeyUser, cp.Name())
+}
+
+func (cp *ChatParticipant) Info() MemberInfo {
+	return MemberInfo{Name: cp.Name(), Bot: cp.Bot}
+}
+
+func (cp *ChatParticipant) Room(roomID string) (*Room, bool) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	room, ok := cp.rooms[roomID]
+	return room, ok
+}
+
+func (cp *ChatParticipant) RoomIDs() []string {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	ids := make([]string, 0, len(cp.rooms))
+	for id := range cp.rooms {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// JoinRoom adds the participant to room. It reports false, and leaves the
+// participant out of the room, if room is closed.
+func (cp *ChatParticipant) JoinRoom(room *Room) bool {
+	cp.mu.Lock()
+	cp.rooms[room.ID] = room
+	cp.mu.Unlock()
+
+	if room.Join(cp) {
+		return true
+	}
+	cp.mu.Lock()
+	if cp.rooms[room.ID] == room {
+		delete(cp.rooms, room.ID)
+	}
+	cp.mu.Unlock()
+	return false
 }
 
 func (cp *ChatParticipant) LeaveRoom(roomID string) {
-	if room, ok := cp.Rooms[roomID]; ok {
+	cp.mu.Lock()
+	room, ok := cp.rooms[roomID]
+	delete(cp.rooms, roomID)
+	cp.mu.Unlock()
+
+	if ok {
+		room.Leave(cp)
+		cp.Logger().Debug("Participant left room", logging.Room(roomID))
+	}
+}
+
+// ExitRoom takes the participant out of room. Unlike LeaveRoom it leaves
+// alone a room since created under the same ID that the participant joined.
+func (cp *ChatParticipant) ExitRoom(room *Room) {
+	cp.mu.Lock()
+	ok := cp.rooms[room.ID] == room
+	if ok {
+		delete(cp.rooms, room.ID)
+	}
+	cp.mu.Unlock()
+
+	if ok {
 		room.Leave(cp)
-		delete(cp.Rooms, roomID)
-		log.Printf("Participant left room %s", roomID)
+		cp.Logger().Debug("Participant left room", logging.Room(room.ID))
 	}
 }
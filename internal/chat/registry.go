@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+)
+
+const registryShards = 64
+
+// RoomRegistry maps room IDs to rooms. Lookups of existing rooms take no
+// locks; creation only locks the shard the ID hashes to, so joins to
+// different rooms do not contend.
+type RoomRegistry struct {
+	seed   maphash.Seed
+	shards [registryShards]registryShard
+	count  atomic.Int64
+}
+
+type registryShard struct {
+	mu    sync.Mutex
+	rooms sync.Map
+}
+
+func NewRoomRegistry() *RoomRegistry {
+	return &RoomRegistry{seed: maphash.MakeSeed()}
+}
+
+func (r *RoomRegistry) shard(id string) *registryShard {
+	return &r.shards[maphash.String(r.seed, id)%registryShards]
+}
+
+func (r *RoomRegistry) Get(id string) (*Room, bool) {
+	room, ok := r.shard(id).rooms.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return room.(*Room), true
+}
+
+// GetOrCreate returns the room registered under id, calling create to make it
+// if there is none. create runs at most once per ID and may start the room.
+// The boolean reports whether this call created the room.
+func (r *RoomRegistry) GetOrCreate(id string, create func() *Room) (*Room, bool) {
+	if room, ok := r.Get(id); ok {
+		return room, false
+	}
+
+	shard := r.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if room, ok := shard.rooms.Load(id); ok {
+		return room.(*Room), false
+	}
+	room := create()
+	shard.rooms.Store(id, room)
+	r.count.Add(1)
+	return room, true
+}
+
+// Delete unregisters the room with the given ID and returns it.
+func (r *RoomRegistry) Delete(id string) (*Room, bool) {
+	shard := r.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	room, ok := shard.rooms.LoadAndDelete(id)
+	if !ok {
+		return nil, false
+	}
+	r.count.Add(-1)
+	return room.(*Room), true
+}
+
+// Range calls fn for every registered room until fn returns false. Rooms
+// created or deleted during the walk may or may not be seen.
+func (r *RoomRegistry) Range(fn func(*Room) bool) {
+	for i := range r.shards {
+		keepGoing := true
+		r.shards[i].rooms.Range(func(_, room interface{}) bool {
+			keepGoing = fn(room.(*Room))
+			return keepGoing
+		})
+		if !keepGoing {
+			return
+		}
+	}
+}
+
+func (r *RoomRegistry) Len() int {
+	return int(r.count.Load())
+}
@@ -1,60 +1,455 @@
 package chat
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"chat/internal/backplane"
+	"chat/internal/logging"
+	"chat/internal/metrics"
+	"chat/internal/tracing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
 )
 
+type RoomInfo struct {
+	ID          string            `json:"id"`
+	Title       string            `json:"title,omitempty"`
+	Topic       string            `json:"topic,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Visibility  string            `json:"visibility"`
+	CreatedAt   time.Time         `json:"created_at"`
+	CreatedBy   string            `json:"created_by,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+}
+
+// RoomSummary is the listing view of a room: its metadata plus live counters.
+type RoomSummary struct {
+	RoomInfo
+	Members      int       `json:"members"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+// RoomUpdate describes a partial change to a room's metadata. Nil fields are
+// left untouched; an attribute set to the empty string is removed.
+type RoomUpdate struct {
+	Title       *string           `json:"title,omitempty"`
+	Topic       *string           `json:"topic,omitempty"`
+	Description *string           `json:"description,omitempty"`
+	Visibility  *string           `json:"visibility,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+}
+
 type Room struct {
 	ID           string
+	info         RoomInfo
+	owner        string
+	lastActivity time.Time
+	seq          uint64
+	seenSeq      atomic.Uint64
+	publishMu    sync.Mutex
 	participants map[*ChatParticipant]bool
-	broadcast    chan []byte
+	broadcast    chan roomBroadcast
 	join         chan *ChatParticipant
 	leave        chan *ChatParticipant
+	quit         chan struct{}
+	stopOnce     sync.Once
 	mu           sync.Mutex
+
+	// closeMu is held for reading by every join in flight, so that Close
+	// can wait them out.
+	closeMu sync.RWMutex
+	closed  bool
+
+	backplane   backplane.Backplane
+	node        string
+	remote      chan roomBroadcast
+	unsubscribe func()
+}
+
+// roomBroadcast is a frame on its way to the Run loop, along with the span
+// that broadcast it, if it is traced.
+type roomBroadcast struct {
+	payload []byte
+	span    trace.SpanContext
+}
+
+// backplaneEnvelope tags a frame with the node that broadcast it, so a node
+// can skip its own frames when the backplane hands them back.
+type backplaneEnvelope struct {
+	Node        string          `json:"node"`
+	Seq         uint64          `json:"seq,omitempty"`
+	TraceParent string          `json:"traceparent,omitempty"`
+	Frame       json.RawMessage `json:"frame"`
 }
 
 func NewRoom(id string) *Room {
+	return NewRoomWithInfo(RoomInfo{ID: id})
+}
+
+func NewRoomWithInfo(info RoomInfo) *Room {
+	if info.CreatedAt.IsZero() {
+		info.CreatedAt = time.Now()
+	}
+	if info.Visibility == "" {
+		info.Visibility = VisibilityPublic
+	}
+	info.Attributes = copyAttributes(info.Attributes)
+
 	return &Room{
-		ID:           id,
+		ID:           info.ID,
+		info:         info,
+		lastActivity: info.CreatedAt,
 		participants: make(map[*ChatParticipant]bool),
-		broadcast:    make(chan []byte),
+		broadcast:    make(chan roomBroadcast),
 		join:         make(chan *ChatParticipant),
 		leave:        make(chan *ChatParticipant),
+		quit:         make(chan struct{}),
 	}
 }
 
+// UseBackplane shares the room's broadcasts with every other node attached to
+// bp, under the node name given. It must be called before Run.
+func (r *Room) UseBackplane(bp backplane.Backplane, node string) {
+	r.backplane = bp
+	r.node = node
+	r.remote = make(chan roomBroadcast, 256)
+}
+
 func (r *Room) Run() {
 	for {
 		select {
 		case participant := <-r.join:
+			r.mu.Lock()
 			r.participants[participant] = true
+			r.mu.Unlock()
 		case participant := <-r.leave:
+			r.mu.Lock()
 			if _, ok := r.participants[participant]; ok {
 				delete(r.participants, participant)
 			}
+			r.mu.Unlock()
 		case message := <-r.broadcast:
-			for participant := range r.participants {
-				select {
-				case participant.Conn.send <- message:
-				default:
-					close(participant.Conn.send)
-					delete(r.participants, participant)
-				}
+			r.deliver(message)
+		case message := <-r.remote:
+			r.deliver(message)
+		case <-r.quit:
+			if r.unsubscribe != nil {
+				r.unsubscribe()
 			}
+			return
 		}
+		r.syncSubscription()
 	}
 }
 
-func (r *Room) Join(participant *ChatParticipant) {
-	r.join <- participant
+func (r *Room) deliver(message roomBroadcast) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start := time.Now()
+	r.lastActivity = start
+	frame := NewBroadcastFrame(message.payload)
+	if message.span.IsValid() {
+		ctx := trace.ContextWithSpanContext(context.Background(), message.span)
+		_, span := tracer.Start(ctx, "room.fanout",
+			trace.WithAttributes(AttrRoom.String(r.ID), AttrMembers.Int(len(r.participants))))
+		defer span.End()
+		frame.span = span.SpanContext()
+		frame.queued = start
+	}
+	for participant := range r.participants {
+		if !participant.Conn.SendFrame(frame) {
+			select {
+			case <-participant.Conn.Done():
+			default:
+				metrics.SlowConsumerDrops.Inc()
+			}
+			participant.Conn.Close()
+			delete(r.participants, participant)
+		}
+	}
+	metrics.BroadcastFanout.Observe(time.Since(start).Seconds())
+}
+
+// syncSubscription keeps the room subscribed to the backplane exactly while
+// it has local members. It only runs on the Run goroutine.
+func (r *Room) syncSubscription() {
+	if r.backplane == nil {
+		return
+	}
+
+	r.mu.Lock()
+	members := len(r.participants)
+	r.mu.Unlock()
+
+	switch {
+	case members > 0 && r.unsubscribe == nil:
+		unsubscribe, err := r.backplane.Subscribe(r.ID, r.receive)
+		if err != nil {
+			slog.Error("Error subscribing room to backplane", logging.Room(r.ID), "error", err)
+			return
+		}
+		r.unsubscribe = unsubscribe
+	case members == 0 && r.unsubscribe != nil:
+		r.unsubscribe()
+		r.unsubscribe = nil
+	}
+}
+
+func (r *Room) receive(payload []byte) {
+	var envelope backplaneEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		slog.Error("Error decoding backplane frame", logging.Room(r.ID), "error", err)
+		return
+	}
+	if envelope.Node == r.node {
+		return
+	}
+	r.ObserveSeq(envelope.Seq)
+
+	message := roomBroadcast{payload: envelope.Frame}
+	ctx := tracing.WithTraceParent(context.Background(), envelope.TraceParent)
+	message.span = trace.SpanContextFromContext(ctx)
+
+	// The backplane delivers every room's frames on one goroutine, so a room
+	// that cannot keep up drops frames rather than hold up the others.
+	select {
+	case r.remote <- message:
+	default:
+		metrics.BackplaneDrops.Inc()
+		slog.Debug("Dropping backplane frame for a room that is behind", logging.Room(r.ID))
+	}
+}
+
+// Stop ends the room's Run loop. Joins, leaves and broadcasts sent to a stopped
+// room are discarded instead of blocking.
+func (r *Room) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.quit)
+	})
+}
+
+// Close makes the room refuse new members ahead of Stop, while it still
+// delivers broadcasts. Joins already under way finish first, so a broadcast
+// sent after Close reaches everyone who will ever have joined.
+func (r *Room) Close() {
+	r.closeMu.Lock()
+	r.closed = true
+	r.closeMu.Unlock()
+}
+
+// Join adds participant to the room. It reports false if the room has been
+// closed or stopped.
+func (r *Room) Join(participant *ChatParticipant) bool {
+	r.closeMu.RLock()
+	defer r.closeMu.RUnlock()
+
+	if r.closed {
+		return false
+	}
+	select {
+	case r.join <- participant:
+		return true
+	case <-r.quit:
+		return false
+	}
 }
 
 func (r *Room) Leave(participant *ChatParticipant) {
-	r.leave <- participant
-	log.Printf("Participant queued to leave room %s", r.ID)
+	select {
+	case r.leave <- participant:
+	case <-r.quit:
+	}
 }
 
 func (r *Room) Broadcast(message []byte) {
-	r.broadcast <- message
+	r.broadcastSeq(context.Background(), message, 0)
+}
+
+// broadcastSeq hands message to the Run loop and the backplane. If ctx holds
+// a span, the broadcast and every delivery of it are traced under it.
+func (r *Room) broadcastSeq(ctx context.Context, message []byte, seq uint64) {
+	var span trace.Span
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		ctx, span = tracer.Start(ctx, "room.broadcast", trace.WithAttributes(AttrRoom.String(r.ID)))
+		defer span.End()
+	}
+
+	select {
+	case r.broadcast <- roomBroadcast{payload: message, span: trace.SpanContextFromContext(ctx)}:
+	case <-r.quit:
+		return
+	}
+
+	if r.backplane == nil {
+		return
+	}
+	payload, err := json.Marshal(backplaneEnvelope{
+		Node:        r.node,
+		Seq:         seq,
+		TraceParent: tracing.TraceParent(ctx),
+		Frame:       message,
+	})
+	if err != nil {
+		slog.Error("Error encoding backplane frame", logging.Room(r.ID), "error", err)
+		return
+	}
+	if err := r.backplane.Publish(ctx, r.ID, payload); err != nil {
+		slog.Error("Error publishing to backplane", logging.Room(r.ID), "error", err)
+	}
+}
+
+// Publish assigns msg the room's next sequence number, hands it to persist and
+// broadcasts it. Publishing is serialised per room so members always receive
+// messages in sequence order.
+func (r *Room) Publish(ctx context.Context, msg *Message, persist func(context.Context, *Message) error) (err error) {
+	ctx, span := tracer.Start(ctx, "room.publish", trace.WithAttributes(AttrRoom.String(r.ID)))
+	defer func() { EndSpan(span, err) }()
+
+	r.publishMu.Lock()
+	defer r.publishMu.Unlock()
+
+	msg.Room = r.ID
+	msg.Seq = r.seq + 1
+	if seen := r.seenSeq.Load(); seen >= msg.Seq {
+		msg.Seq = seen + 1
+	}
+	payload, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+	if persist != nil {
+		if err := persist(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	r.seq = msg.Seq
+	r.broadcastSeq(ctx, payload, msg.Seq)
+	return nil
+}
+
+// ObserveSeq records a sequence number assigned to this room by another node,
+// so that numbering carries on from it if this node takes over the room.
+func (r *Room) ObserveSeq(seq uint64) {
+	for {
+		seen := r.seenSeq.Load()
+		if seq <= seen || r.seenSeq.CompareAndSwap(seen, seq) {
+			return
+		}
+	}
+}
+
+func (r *Room) Members() []*ChatParticipant {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members := make([]*ChatParticipant, 0, len(r.participants))
+	for participant := range r.participants {
+		members = append(members, participant)
+	}
+	return members
+}
+
+func (r *Room) MemberCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.participants)
+}
+
+// Owner returns the ID of the connection that owns the room: the member who
+// opened it or, for rooms opened over HTTP, the first member to join. Unlike
+// RoomInfo.CreatedBy, which clients supply, it is set by the server and can be
+// trusted.
+func (r *Room) Owner() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.owner
+}
+
+func (r *Room) SetOwner(connID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.owner = connID
+}
+
+// ClaimOwner makes connID the room's owner if it has none yet.
+func (r *Room) ClaimOwner(connID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.owner == "" {
+		r.owner = connID
+	}
+}
+
+func (r *Room) Info() RoomInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info := r.info
+	info.Attributes = copyAttributes(r.info.Attributes)
+	return info
+}
+
+func (r *Room) Summary() RoomSummary {
+	info := r.Info()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return RoomSummary{
+		RoomInfo:     info,
+		Members:      len(r.participants),
+		LastActivity: r.lastActivity,
+	}
+}
+
+func (r *Room) Update(update RoomUpdate) RoomInfo {
+	r.mu.Lock()
+	if update.Title != nil {
+		r.info.Title = *update.Title
+	}
+	if update.Topic != nil {
+		r.info.Topic = *update.Topic
+	}
+	if update.Description != nil {
+		r.info.Description = *update.Description
+	}
+	if update.Visibility != nil {
+		r.info.Visibility = *update.Visibility
+	}
+	for key, value := range update.Attributes {
+		if value == "" {
+			delete(r.info.Attributes, key)
+			continue
+		}
+		if r.info.Attributes == nil {
+			r.info.Attributes = make(map[string]string)
+		}
+		r.info.Attributes[key] = value
+	}
+	r.mu.Unlock()
+
+	return r.Info()
+}
+
+func copyAttributes(attributes map[string]string) map[string]string {
+	if len(attributes) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		copied[key] = value
+	}
+	return copied
 }
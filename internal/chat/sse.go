@@ -0,0 +1,198 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrTransportClosed = errors.New("transport closed")
+
+// SSETransport streams frames to the client as Server-Sent Events and takes
+// inbound frames from Push, which the paired HTTP POST endpoints call.
+//
+// Every chat message carries its room sequence number. The event ID lists the
+// last sequence number delivered per room ("lobby:12,ops:40", with room names
+// query-escaped), so a client
+// reconnecting with Last-Event-ID can resume every room it follows.
+type SSETransport struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	inbound chan []byte
+	closed  chan struct{}
+	once    sync.Once
+
+	mu      sync.Mutex
+	lastSeq map[string]uint64
+}
+
+func NewSSETransport(w http.ResponseWriter) (*SSETransport, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming unsupported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &SSETransport{
+		w:       w,
+		flusher: flusher,
+		inbound: make(chan []byte, 64),
+		closed:  make(chan struct{}),
+		lastSeq: make(map[string]uint64),
+	}, nil
+}
+
+// ParseEventID decodes an event ID produced by the transport into the last
+// sequence number seen per room.
+func ParseEventID(id string) map[string]uint64 {
+	seqs := make(map[string]uint64)
+	for _, part := range strings.Split(id, ",") {
+		escaped, seq, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			continue
+		}
+		room, err := url.QueryUnescape(escaped)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs[room] = n
+	}
+	return seqs
+}
+
+// Resume marks everything up to the given sequence numbers as delivered, so
+// replayed history and live traffic are not sent twice.
+func (t *SSETransport) Resume(seqs map[string]uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for room, seq := range seqs {
+		if seq > t.lastSeq[room] {
+			t.lastSeq[room] = seq
+		}
+	}
+}
+
+func (t *SSETransport) Push(message []byte) error {
+	select {
+	case <-t.closed:
+		return ErrTransportClosed
+	default:
+	}
+
+	select {
+	case t.inbound <- message:
+		return nil
+	case <-t.closed:
+		return ErrTransportClosed
+	}
+}
+
+func (t *SSETransport) ReadMessage() ([]byte, error) {
+	select {
+	case message := <-t.inbound:
+		return message, nil
+	case <-t.closed:
+		return nil, io.EOF
+	}
+}
+
+func (t *SSETransport) WriteMessage(message []byte) error {
+	var header struct {
+		Type string `json:"type"`
+		Room string `json:"room"`
+		Seq  uint64 `json:"seq"`
+	}
+	json.Unmarshal(message, &header)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	select {
+	case <-t.closed:
+		return ErrTransportClosed
+	default:
+	}
+
+	id := ""
+	if header.Seq > 0 {
+		if header.Seq <= t.lastSeq[header.Room] {
+			return nil
+		}
+		t.lastSeq[header.Room] = header.Seq
+		id = t.eventID()
+	}
+
+	if id != "" {
+		fmt.Fprintf(t.w, "id: %s\n", id)
+	}
+	for _, line := range strings.Split(string(message), "\n") {
+		fmt.Fprintf(t.w, "data: %s\n", line)
+	}
+	if _, err := io.WriteString(t.w, "\n"); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+// Heartbeat writes an SSE comment so idle proxies keep the stream open.
+func (t *SSETransport) Heartbeat() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	select {
+	case <-t.closed:
+		return ErrTransportClosed
+	default:
+	}
+
+	if _, err := io.WriteString(t.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+func (t *SSETransport) Close() error {
+	t.once.Do(func() {
+		t.mu.Lock()
+		close(t.closed)
+		t.mu.Unlock()
+	})
+	return nil
+}
+
+func (t *SSETransport) Done() <-chan struct{} {
+	return t.closed
+}
+
+func (t *SSETransport) eventID() string {
+	rooms := make([]string, 0, len(t.lastSeq))
+	for room := range t.lastSeq {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+
+	parts := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		parts = append(parts, url.QueryEscape(room)+":"+strconv.FormatUint(t.lastSeq[room], 10))
+	}
+	return strings.Join(parts, ",")
+}
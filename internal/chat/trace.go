@@ -0,0 +1,27 @@
+package chat
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("chat/internal/chat")
+
+// Span attribute keys used across the message path.
+const (
+	AttrRoom      = attribute.Key("chat.room")
+	AttrConn      = attribute.Key("chat.conn_id")
+	AttrFrameType = attribute.Key("chat.frame.type")
+	AttrMembers   = attribute.Key("chat.room.members")
+)
+
+// EndSpan records err, if any, on span and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries frames between a Connection and its client. ReadMessage
+// returns io.EOF once the client has gone away cleanly. WriteMessage is only
+// ever called from the connection's write pump; Close may be called from any
+// goroutine, more than once.
+type Transport interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage(message []byte) error
+	Close() error
+}
+
+// FrameWriter is implemented by transports that can write a broadcast frame,
+// or a batch of them, more cheaply than its encoded bytes. The write pump
+// prefers it for frames created with NewBroadcastFrame.
+type FrameWriter interface {
+	WriteFrame(frame *Frame, codec Codec) error
+	WriteBatch(frames []*Frame, mode string, codec Codec) error
+}
+
+const closeGracePeriod = time.Second
+
+type WebSocketTransport struct {
+	conn        *websocket.Conn
+	messageType int
+	compress    bool
+	threshold   int
+	wire        *CountingConn
+}
+
+// WebSocketOptions tune a WebSocket transport. Compression only takes effect
+// when permessage-deflate was negotiated during the upgrade; messages shorter
+// than CompressionThreshold bytes are always sent uncompressed.
+type WebSocketOptions struct {
+	Binary               bool
+	Compress             bool
+	CompressionThreshold int
+	CompressionLevel     int
+}
+
+// NewWebSocketTransport writes text messages, or binary ones when the
+// connection's codec is binary.
+func NewWebSocketTransport(conn *websocket.Conn, opts WebSocketOptions) *WebSocketTransport {
+	t := &WebSocketTransport{
+		conn:        conn,
+		messageType: websocket.TextMessage,
+		compress:    opts.Compress,
+		threshold:   opts.CompressionThreshold,
+	}
+	if opts.Binary {
+		t.messageType = websocket.BinaryMessage
+	}
+	if t.compress {
+		if err := conn.SetCompressionLevel(opts.CompressionLevel); err != nil {
+			slog.Error("Error setting compression level", "error", err)
+		}
+		t.wire, _ = conn.NetConn().(*CountingConn)
+	}
+	conn.EnableWriteCompression(false)
+	return t
+}
+
+func (t *WebSocketTransport) ReadMessage() ([]byte, error) {
+	_, message, err := t.conn.ReadMessage()
+	if err != nil {
+		if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return message, nil
+}
+
+func (t *WebSocketTransport) WriteMessage(message []byte) error {
+	return t.write(len(message), func() error {
+		w, err := t.conn.NextWriter(t.messageType)
+		if err != nil {
+			return err
+		}
+		w.Write(message)
+		return w.Close()
+	})
+}
+
+// WriteFrame writes a broadcast frame as a prepared message, reusing the
+// framing, and compression if any, of every other recipient using codec.
+func (t *WebSocketTransport) WriteFrame(frame *Frame, codec Codec) error {
+	pm, data, err := frame.Prepared(codec)
+	if err != nil {
+		return err
+	}
+	return t.write(len(data), func() error {
+		return t.conn.WritePreparedMessage(pm)
+	})
+}
+
+// WriteBatch writes a batch of broadcast frames as a prepared message, shared
+// with every other member that batched the same frames.
+func (t *WebSocketTransport) WriteBatch(frames []*Frame, mode string, codec Codec) error {
+	pm, data, err := prepareBatch(frames, mode, codec)
+	if err != nil {
+		return err
+	}
+	return t.write(len(data), func() error {
+		return t.conn.WritePreparedMessage(pm)
+	})
+}
+
+// write runs fn with compression switched on or off for a message of size
+// bytes and records the outcome in the compression stats.
+func (t *WebSocketTransport) write(size int, fn func() error) error {
+	compress := t.compress && size >= t.threshold
+	if t.compress && !compress {
+		Compression.Skipped.Add(1)
+	}
+	t.conn.EnableWriteCompression(compress)
+
+	var before uint64
+	if compress && t.wire != nil {
+		before = t.wire.Written()
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	if compress && t.wire != nil {
+		Compression.Messages.Add(1)
+		Compression.PayloadBytes.Add(uint64(size))
+		Compression.WireBytes.Add(t.wire.Written() - before)
+	}
+	return nil
+}
+
+func (t *WebSocketTransport) Close() error {
+	t.conn.WriteControl(websocket.CloseMessage, []byte{}, time.Now().Add(closeGracePeriod))
+	return t.conn.Close()
+}
@@ -0,0 +1,339 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chat/internal/chat"
+	"chat/internal/tracing"
+)
+
+// ErrNotFound is returned when the owner does not know the requested room.
+var ErrNotFound = errors.New("room not found on owner")
+
+// ErrNoSecret is returned by New when no shared secret is configured.
+var ErrNoSecret = errors.New("cluster secret is required")
+
+// SecretHeader carries the shared cluster secret on node-to-node requests.
+const SecretHeader = "X-Cluster-Secret"
+
+const (
+	defaultHeartbeat = 2 * time.Second
+	defaultTimeout   = 5 * time.Second
+)
+
+// Peer is a node of the cluster, reachable at URL.
+type Peer struct {
+	ID  string
+	URL string
+}
+
+// ParsePeers reads a comma-separated list of id=url pairs.
+func ParsePeers(value string) ([]Peer, error) {
+	var peers []Peer
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, rawURL, ok := strings.Cut(entry, "=")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid peer %q, want id=url", entry)
+		}
+		if _, err := url.ParseRequestURI(rawURL); err != nil {
+			return nil, fmt.Errorf("invalid peer %q: %v", entry, err)
+		}
+		peers = append(peers, Peer{ID: id, URL: strings.TrimSuffix(rawURL, "/")})
+	}
+	return peers, nil
+}
+
+type Options struct {
+	// Self is this node's ID; it must be one of Peers.
+	Self  string
+	Peers []Peer
+
+	// Secret authenticates requests between nodes. It is required, since
+	// nodes accept messages from each other as is.
+	Secret    string
+	Heartbeat time.Duration
+	Client    *http.Client
+}
+
+// Cluster tracks which of a static set of peers are alive and places rooms on
+// them with a consistent-hash ring. Peers are checked with a heartbeat; one
+// that misses a heartbeat leaves the ring until it answers again, and its
+// rooms move to the next node on the ring.
+type Cluster struct {
+	self      Peer
+	peers     map[string]Peer
+	secret    string
+	heartbeat time.Duration
+	client    *http.Client
+
+	mu    sync.RWMutex
+	ring  *Ring
+	alive map[string]bool
+	epoch atomic.Uint64
+}
+
+func New(opts Options) (*Cluster, error) {
+	if opts.Secret == "" {
+		return nil, ErrNoSecret
+	}
+	c := &Cluster{
+		peers:     make(map[string]Peer),
+		secret:    opts.Secret,
+		heartbeat: opts.Heartbeat,
+		client:    opts.Client,
+		ring:      NewRing(0),
+		alive:     make(map[string]bool),
+	}
+	if c.heartbeat <= 0 {
+		c.heartbeat = defaultHeartbeat
+	}
+	if c.client == nil {
+		c.client = &http.Client{Timeout: defaultTimeout}
+	}
+
+	for _, peer := range opts.Peers {
+		c.peers[peer.ID] = peer
+		c.alive[peer.ID] = true
+		c.ring.Add(peer.ID)
+	}
+	self, ok := c.peers[opts.Self]
+	if !ok {
+		return nil, fmt.Errorf("node %q is not one of the cluster peers", opts.Self)
+	}
+	c.self = self
+	c.epoch.Store(1)
+	return c, nil
+}
+
+func (c *Cluster) Self() Peer {
+	return c.self
+}
+
+// Owner returns the peer that owns room and whether that is this node.
+func (c *Cluster) Owner(room string) (Peer, bool) {
+	c.mu.RLock()
+	id := c.ring.Owner(room)
+	c.mu.RUnlock()
+	return c.peers[id], id == c.self.ID
+}
+
+// Successor returns the peer that would own room if this node left the ring,
+// which keeps a replica of the room's history. It reports false if this node
+// is the only member.
+func (c *Cluster) Successor(room string) (Peer, bool) {
+	c.mu.RLock()
+	id := c.ring.OwnerExcept(room, c.self.ID)
+	c.mu.RUnlock()
+	peer, ok := c.peers[id]
+	return peer, ok
+}
+
+// Peers returns every other configured peer, alive or not.
+func (c *Cluster) Peers() []Peer {
+	peers := make([]Peer, 0, len(c.peers)-1)
+	for _, peer := range c.peers {
+		if peer.ID != c.self.ID {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// Epoch counts changes to the ring as seen by this node. Room ownership can
+// only have moved when it changes.
+func (c *Cluster) Epoch() uint64 {
+	return c.epoch.Load()
+}
+
+// Members returns the IDs of the peers currently in the ring.
+func (c *Cluster) Members() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ring.Nodes()
+}
+
+// Run sends heartbeats to the other peers until ctx is cancelled.
+func (c *Cluster) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		c.checkPeers(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Cluster) checkPeers(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, peer := range c.peers {
+		if peer.ID == c.self.ID {
+			continue
+		}
+		wg.Add(1)
+		go func(peer Peer) {
+			defer wg.Done()
+			c.setAlive(peer.ID, c.ping(ctx, peer) == nil)
+		}(peer)
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) setAlive(id string, alive bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.alive[id] == alive {
+		return
+	}
+	c.alive[id] = alive
+	c.epoch.Add(1)
+	if alive {
+		c.ring.Add(id)
+		slog.Info("Cluster peer joined", "peer", id)
+	} else {
+		c.ring.Remove(id)
+		slog.Warn("Cluster peer left", "peer", id)
+	}
+}
+
+func (c *Cluster) ping(ctx context.Context, peer Peer) error {
+	ctx, cancel := context.WithTimeout(ctx, c.heartbeat)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, peer.URL+"/cluster/ping", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Authorized reports whether r carries the cluster secret.
+func (c *Cluster) Authorized(r *http.Request) bool {
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(SecretHeader)), []byte(c.secret)) == 1
+}
+
+// Forward hands msg to the room's owner, which assigns its sequence number,
+// stores it and broadcasts it. It returns the message as stored.
+func (c *Cluster) Forward(ctx context.Context, owner Peer, msg *chat.Message) (*chat.Message, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, owner.URL+"/cluster/rooms/"+url.PathEscape(msg.Room)+"/messages", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var stored chat.Message
+	if err := json.NewDecoder(resp.Body).Decode(&stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// History asks the room's owner for the messages after seq.
+func (c *Cluster) History(ctx context.Context, owner Peer, room string, seq uint64, limit int) ([]*chat.Message, error) {
+	query := url.Values{
+		"after": {strconv.FormatUint(seq, 10)},
+		"limit": {strconv.Itoa(limit)},
+	}
+	resp, err := c.do(ctx, http.MethodGet, owner.URL+"/cluster/rooms/"+url.PathEscape(room)+"/history?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var messages []*chat.Message
+	if err := json.NewDecoder(resp.Body).Decode(&messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Replicate hands messages of one room, in sequence order, to peer for
+// safekeeping.
+func (c *Cluster) Replicate(ctx context.Context, peer Peer, messages []*chat.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, peer.URL+"/cluster/rooms/"+url.PathEscape(messages[0].Room)+"/replica", body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Replica returns the messages after seq that peer holds for room, whether
+// it owns the room or keeps a replica.
+func (c *Cluster) Replica(ctx context.Context, peer Peer, room string, seq uint64) ([]*chat.Message, error) {
+	query := url.Values{"after": {strconv.FormatUint(seq, 10)}}
+	resp, err := c.do(ctx, http.MethodGet, peer.URL+"/cluster/rooms/"+url.PathEscape(room)+"/replica?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var messages []*chat.Message
+	if err := json.NewDecoder(resp.Body).Decode(&messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// do sends an authenticated request to a peer and turns non-2xx replies into
+// errors.
+func (c *Cluster) do(ctx context.Context, method, target string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(SecretHeader, c.secret)
+	tracing.InjectHeader(ctx, req.Header)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s: %s", method, target, resp.Status, strings.TrimSpace(string(reason)))
+	}
+	return resp, nil
+}
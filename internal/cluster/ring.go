@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+const defaultReplicas = 128
+
+// Ring is a consistent-hash ring. Every node is placed at several points so
+// that keys spread evenly and only the keys of a joining or leaving node move.
+// A Ring is not safe for concurrent modification.
+type Ring struct {
+	replicas int
+	points   []uint64
+	owners   map[uint64]string
+	nodes    map[string]bool
+}
+
+func NewRing(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &Ring{
+		replicas: replicas,
+		owners:   make(map[uint64]string),
+		nodes:    make(map[string]bool),
+	}
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func (r *Ring) Add(node string) {
+	if r.nodes[node] {
+		return
+	}
+	r.nodes[node] = true
+	for i := 0; i < r.replicas; i++ {
+		point := hashKey(node + "#" + strconv.Itoa(i))
+		r.owners[point] = node
+		r.points = append(r.points, point)
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+func (r *Ring) Remove(node string) {
+	if !r.nodes[node] {
+		return
+	}
+	delete(r.nodes, node)
+	points := r.points[:0]
+	for _, point := range r.points {
+		if r.owners[point] == node {
+			delete(r.owners, point)
+			continue
+		}
+		points = append(points, point)
+	}
+	r.points = points
+}
+
+// Owner returns the node responsible for key, or "" for an empty ring.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// OwnerExcept returns the node that would own key if node left the ring, or ""
+// if no other node is left.
+func (r *Ring) OwnerExcept(key, node string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	for n := 0; n < len(r.points); n++ {
+		if owner := r.owners[r.points[(i+n)%len(r.points)]]; owner != node {
+			return owner
+		}
+	}
+	return ""
+}
+
+func (r *Ring) Nodes() []string {
+	nodes := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
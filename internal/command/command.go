@@ -0,0 +1,169 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"chat/internal/chat"
+)
+
+const (
+	EventSystem = "system"
+	Prefix      = "/"
+)
+
+// Context is handed to a command handler. Args holds the whitespace separated
+// arguments; Text holds everything after the command name verbatim.
+type Context struct {
+	Participant *chat.ChatParticipant
+	Room        *chat.Room
+	Name        string
+	Args        []string
+	Text        string
+}
+
+// Reply sends a system message to the issuer only.
+func (c *Context) Reply(format string, args ...interface{}) {
+	content := fmt.Sprintf(format, args...)
+	c.Participant.Conn.Send(chat.NewEvent(EventSystem, c.Room.ID, map[string]string{"content": content}))
+}
+
+// Emit broadcasts an event to every member of the room.
+func (c *Context) Emit(eventType string, data interface{}) {
+	c.Room.Broadcast(chat.NewEvent(eventType, c.Room.ID, data))
+}
+
+type Handler func(ctx *Context) error
+
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	MinArgs     int
+	// MaxArgs of -1 allows any number of arguments.
+	MaxArgs int
+	// Writes marks commands that change a room; the write guard is checked
+	// before they run.
+	Writes  bool
+	Handler Handler
+}
+
+func (c *Command) validate(args []string) error {
+	if len(args) < c.MinArgs || (c.MaxArgs >= 0 && len(args) > c.MaxArgs) {
+		return fmt.Errorf("usage: %s", c.synopsis())
+	}
+	return nil
+}
+
+func (c *Command) synopsis() string {
+	if c.Usage == "" {
+		return Prefix + c.Name
+	}
+	return Prefix + c.Name + " " + c.Usage
+}
+
+type Registry struct {
+	commands map[string]*Command
+	guard    func() error
+}
+
+// NewRegistry returns a registry that already knows /help.
+func NewRegistry() *Registry {
+	r := &Registry{commands: make(map[string]*Command)}
+	r.Register(Command{
+		Name:        "help",
+		Usage:       "[command]",
+		Description: "List commands or describe one",
+		MaxArgs:     1,
+		Handler:     r.help,
+	})
+	return r
+}
+
+// SetWriteGuard installs a check run before every command marked Writes. An
+// error refuses the command and is reported to the issuer.
+func (r *Registry) SetWriteGuard(guard func() error) {
+	r.guard = guard
+}
+
+func (r *Registry) Register(cmd Command) error {
+	name := strings.ToLower(cmd.Name)
+	if name == "" || strings.ContainsAny(name, " \t/") {
+		return fmt.Errorf("invalid command name %q", cmd.Name)
+	}
+	if cmd.Handler == nil {
+		return fmt.Errorf("command %q has no handler", cmd.Name)
+	}
+	if _, exists := r.commands[name]; exists {
+		return fmt.Errorf("command %q already registered", cmd.Name)
+	}
+	cmd.Name = name
+	r.commands[name] = &cmd
+	return nil
+}
+
+// IsCommand reports whether content should be routed to the registry. A double
+// prefix ("//") escapes the command syntax and is sent as ordinary text.
+func IsCommand(content string) bool {
+	return strings.HasPrefix(content, Prefix) && !strings.HasPrefix(content, Prefix+Prefix)
+}
+
+// Dispatch parses content and runs the matching command. Usage and handler
+// errors are reported back to the issuer.
+func (r *Registry) Dispatch(participant *chat.ChatParticipant, room *chat.Room, content string) {
+	line := strings.TrimPrefix(content, Prefix)
+	name, text, _ := strings.Cut(line, " ")
+	ctx := &Context{
+		Participant: participant,
+		Room:        room,
+		Name:        strings.ToLower(name),
+		Args:        strings.Fields(text),
+		Text:        strings.TrimSpace(text),
+	}
+
+	cmd, ok := r.commands[ctx.Name]
+	if !ok {
+		ctx.Reply("Unknown command %s%s, try %shelp", Prefix, name, Prefix)
+		return
+	}
+	if err := cmd.validate(ctx.Args); err != nil {
+		ctx.Reply("%v", err)
+		return
+	}
+	if cmd.Writes && r.guard != nil {
+		if err := r.guard(); err != nil {
+			ctx.Reply("%s%s: %v", Prefix, cmd.Name, err)
+			return
+		}
+	}
+	if err := cmd.Handler(ctx); err != nil {
+		ctx.Reply("%s%s: %v", Prefix, cmd.Name, err)
+	}
+}
+
+func (r *Registry) help(ctx *Context) error {
+	if len(ctx.Args) == 1 {
+		cmd, ok := r.commands[strings.ToLower(strings.TrimPrefix(ctx.Args[0], Prefix))]
+		if !ok {
+			return errors.New("no such command")
+		}
+		ctx.Reply("%s - %s", cmd.synopsis(), cmd.Description)
+		return nil
+	}
+
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		cmd := r.commands[name]
+		lines = append(lines, fmt.Sprintf("%s - %s", cmd.synopsis(), cmd.Description))
+	}
+	ctx.Reply("%s", strings.Join(lines, "\n"))
+	return nil
+}
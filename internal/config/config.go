@@ -1,18 +1,283 @@
 package config
 
-import "os"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
 
 type Config struct {
-	Address string
+	Address     string
+	TCPAddress  string
+	IRCAddress  string
+	GRPCAddress string
+
+	// TLSCertFile and TLSKeyFile switch the HTTP listener to HTTPS. They
+	// are set together or not at all.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// GRPCTLSCertFile and GRPCTLSKeyFile do the same for the gRPC listener.
+	GRPCTLSCertFile string
+	GRPCTLSKeyFile  string
+
+	// StaticDir is served under /static/ and IndexFile at /.
+	StaticDir string
+	IndexFile string
+
+	RedisURL         string
+	HistorySize      int
+	MaxMessageLength int
+	BannedWordsFile  string
+	BlockLinks       bool
+	APIKeys          []string
+	AdminKeys        []string
+	PollSessionTTL   time.Duration
+
+	// MaxConnections is the connection count at which the server reports
+	// itself not ready; zero means no ceiling. DrainPeriod is how long the
+	// server keeps serving after a shutdown signal while it reports itself
+	// not ready, so load balancers stop sending it clients.
+	MaxConnections  int
+	DrainPeriod     time.Duration
+	ShutdownTimeout time.Duration
+
+	ReadHeaderTimeout time.Duration
+
+	// ReadBufferSize and WriteBufferSize size the WebSocket upgrader's I/O
+	// buffers.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// Compression enables permessage-deflate for WebSocket clients that ask
+	// for it. Frames shorter than CompressionThreshold bytes are sent as is.
+	// A CompressionLevel of zero selects the default level.
+	Compression          bool
+	CompressionThreshold int
+	CompressionLevel     int
+
+	// BatchMaxMessages and BatchMaxDelay cap write coalescing for WebSocket
+	// clients that opt into batched frames.
+	BatchMaxMessages int
+	BatchMaxDelay    time.Duration
+
+	// WebhookQueueKey encrypts subscription secrets in the files under
+	// WebhookQueueDir.
+	WebhookQueueDir    string
+	WebhookQueueKey    string
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+
+	// NodeID names this server among ClusterPeers, a comma-separated list of
+	// id=url pairs covering every node, this one included.
+	NodeID           string
+	ClusterPeers     string
+	ClusterSecret    string
+	ClusterHeartbeat time.Duration
+
+	// LogFormat is text or json. Message content is redacted from the logs
+	// unless LogContent is set.
+	LogLevel   slog.Level
+	LogFormat  string
+	LogContent bool
+
+	// OTLPEndpoint, host:port, enables tracing. TraceSampleRatio applies to
+	// every trace the server starts, including those linked to a client's.
+	OTLPEndpoint     string
+	OTLPInsecure     bool
+	TraceSampleRatio float64
+
+	// PrintConfig is set by the -print-config flag: the caller should write
+	// the configuration out with Print instead of starting the server.
+	PrintConfig bool
 }
 
-func Load() (*Config, error) {
-	address := os.Getenv("SERVER_ADDRESS")
-	if address == "" {
-		address = ":8080"
+// Default returns the configuration used when nothing overrides it.
+func Default() *Config {
+	return &Config{
+		Address:              ":8080",
+		StaticDir:            "./web/static",
+		IndexFile:            "./web/templates/index.html",
+		HistorySize:          1000,
+		MaxMessageLength:     4096,
+		ShutdownTimeout:      10 * time.Second,
+		ReadHeaderTimeout:    10 * time.Second,
+		ReadBufferSize:       1024,
+		WriteBufferSize:      1024,
+		CompressionThreshold: 512,
+		LogFormat:            "text",
+		TraceSampleRatio:     1,
 	}
+}
 
-	return &Config{
-		Address: address,
-	}, nil
+// Load builds the configuration in layers, each overriding the one before:
+// the defaults, the YAML or JSON file named by -config or CONFIG_FILE, the
+// environment and finally the command-line flags in args. The result is
+// validated, and every invalid value is reported.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	fields := cfg.fields()
+
+	// Flags are parsed first to find -config, but only applied last.
+	fs := flag.NewFlagSet("chat", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var set []flagValue
+	for _, f := range fields {
+		if f.secret {
+			continue
+		}
+		fs.Var(&recorder{field: f, set: &set}, f.key, fmt.Sprintf("%s ($%s)", f.usage, f.env))
+	}
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON configuration file ($CONFIG_FILE)")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective configuration and exit")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, usageError(usage(fs, fields))
+		}
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if *configFile != "" {
+		if err := applyFile(fields, *configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, f := range fields {
+		if value, ok := os.LookupEnv(f.env); ok && value != "" {
+			if err := f.value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid value %q: %w", f.env, value, err))
+			}
+		}
+	}
+	for _, v := range set {
+		if err := v.field.value.Set(v.value); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: invalid value %q: %w", v.field.key, v.value, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func applyFile(fields []field, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// JSON is a subset of YAML, so one decoder reads both.
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	byKey := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byKey[f.key] = f
+	}
+
+	var errs []error
+	for key, raw := range values {
+		f, ok := byKey[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, key))
+			continue
+		}
+		value, err := fileValue(raw)
+		if err == nil {
+			err = f.value.Set(value)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fileValue turns a decoded file value into the string form accepted from
+// the environment and flags. Lists become comma-separated.
+func fileValue(raw interface{}) (string, error) {
+	switch v := raw.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := fileValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		return "", errors.New("must not be a mapping")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// Print writes the configuration as YAML that Load accepts back as a file,
+// with keys, secrets and passwords redacted.
+func (c *Config) Print(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, f := range c.fields() {
+		value := f.value.get()
+		if f.redact != nil && f.value.String() != "" {
+			value = f.redact(f.value.String())
+		}
+		var node yaml.Node
+		if err := node.Encode(value); err != nil {
+			return err
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.key}, &node)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+const redacted = "[redacted]"
+
+// usageError answers -h with the flag documentation. It wraps
+// flag.ErrHelp.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+func (e usageError) Unwrap() error { return flag.ErrHelp }
+
+func usage(fs *flag.FlagSet, fields []field) string {
+	var b strings.Builder
+	b.WriteString("Usage of chat:\n")
+	fs.SetOutput(&b)
+	fs.PrintDefaults()
+	fs.SetOutput(io.Discard)
+
+	b.WriteString("\nSecrets are read from the configuration file or the environment only:\n")
+	for _, f := range fields {
+		if f.secret {
+			fmt.Fprintf(&b, "  %s ($%s)\n    \t%s\n", f.key, f.env, f.usage)
+		}
+	}
+	return b.String()
 }
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field binds one setting to its name in a configuration file and on the
+// command line (key) and in the environment (env).
+type field struct {
+	key   string
+	env   string
+	usage string
+	value value
+
+	// redact, if set, hides secrets in the value when it is printed.
+	redact func(string) string
+
+	// secret settings have no flag, since a command line is visible to
+	// every user of the host; they come from the file or the environment.
+	secret bool
+}
+
+func (c *Config) fields() []field {
+	return []field{
+		{key: "address", env: "SERVER_ADDRESS", usage: "HTTP listen address", value: (*stringValue)(&c.Address)},
+		{key: "tcp-address", env: "TCP_ADDRESS", usage: "TCP gateway listen address", value: (*stringValue)(&c.TCPAddress)},
+		{key: "irc-address", env: "IRC_ADDRESS", usage: "IRC gateway listen address", value: (*stringValue)(&c.IRCAddress)},
+		{key: "grpc-address", env: "GRPC_ADDRESS", usage: "gRPC listen address", value: (*stringValue)(&c.GRPCAddress)},
+		{key: "tls-cert-file", env: "TLS_CERT_FILE", usage: "TLS certificate for the HTTP listener", value: (*stringValue)(&c.TLSCertFile)},
+		{key: "tls-key-file", env: "TLS_KEY_FILE", usage: "TLS private key for the HTTP listener", value: (*stringValue)(&c.TLSKeyFile)},
+		{key: "grpc-tls-cert-file", env: "GRPC_TLS_CERT_FILE", usage: "TLS certificate for the gRPC listener", value: (*stringValue)(&c.GRPCTLSCertFile)},
+		{key: "grpc-tls-key-file", env: "GRPC_TLS_KEY_FILE", usage: "TLS private key for the gRPC listener", value: (*stringValue)(&c.GRPCTLSKeyFile)},
+		{key: "static-dir", env: "STATIC_DIR", usage: "directory served under /static/", value: (*stringValue)(&c.StaticDir)},
+		{key: "index-file", env: "INDEX_FILE", usage: "page served at /", value: (*stringValue)(&c.IndexFile)},
+
+		{key: "redis-url", env: "REDIS_URL", usage: "Redis backplane URL", value: (*stringValue)(&c.RedisURL), redact: redactURL},
+		{key: "history-size", env: "HISTORY_SIZE", usage: "messages kept per room in memory", value: (*intValue)(&c.HistorySize)},
+		{key: "max-message-length", env: "MAX_MESSAGE_LENGTH", usage: "longest chat message accepted, 0 for no limit", value: (*intValue)(&c.MaxMessageLength)},
+		{key: "banned-words-file", env: "BANNED_WORDS_FILE", usage: "file of words rejected in messages", value: (*stringValue)(&c.BannedWordsFile)},
+		{key: "block-links", env: "BLOCK_LINKS", usage: "reject messages containing links", value: (*boolValue)(&c.BlockLinks)},
+		{key: "api-keys", env: "API_KEYS", usage: "comma-separated API keys", value: (*listValue)(&c.APIKeys), redact: redactAll, secret: true},
+		{key: "admin-keys", env: "ADMIN_KEYS", usage: "comma-separated admin API keys", value: (*listValue)(&c.AdminKeys), redact: redactAll, secret: true},
+		{key: "poll-session-ttl", env: "POLL_SESSION_TTL", usage: "idle time before a long-polling session expires", value: (*durationValue)(&c.PollSessionTTL)},
+
+		{key: "max-connections", env: "MAX_CONNECTIONS", usage: "connections at which the server reports not ready, 0 for no limit", value: (*intValue)(&c.MaxConnections)},
+		{key: "drain-period", env: "DRAIN_PERIOD", usage: "time to keep serving after a shutdown signal", value: (*durationValue)(&c.DrainPeriod)},
+		{key: "shutdown-timeout", env: "SHUTDOWN_TIMEOUT", usage: "time allowed for open requests to finish on shutdown", value: (*durationValue)(&c.ShutdownTimeout)},
+		{key: "read-header-timeout", env: "READ_HEADER_TIMEOUT", usage: "time allowed to read HTTP request headers, 0 for no limit", value: (*durationValue)(&c.ReadHeaderTimeout)},
+
+		{key: "ws-read-buffer-size", env: "WS_READ_BUFFER_SIZE", usage: "WebSocket read buffer size in bytes", value: (*intValue)(&c.ReadBufferSize)},
+		{key: "ws-write-buffer-size", env: "WS_WRITE_BUFFER_SIZE", usage: "WebSocket write buffer size in bytes", value: (*intValue)(&c.WriteBufferSize)},
+		{key: "ws-compression", env: "WS_COMPRESSION", usage: "enable WebSocket permessage-deflate", value: (*boolValue)(&c.Compression)},
+		{key: "ws-compression-threshold", env: "WS_COMPRESSION_THRESHOLD", usage: "smallest frame compressed, in bytes", value: (*intValue)(&c.CompressionThreshold)},
+		{key: "ws-compression-level", env: "WS_COMPRESSION_LEVEL", usage: "deflate level from -2 to 9, 0 for the default", value: (*intValue)(&c.CompressionLevel)},
+		{key: "ws-batch-max-messages", env: "WS_BATCH_MAX_MESSAGES", usage: "most messages coalesced into one batched frame, 0 for the default", value: (*intValue)(&c.BatchMaxMessages)},
+		{key: "ws-batch-max-delay", env: "WS_BATCH_MAX_DELAY", usage: "longest a message waits to be batched", value: (*durationValue)(&c.BatchMaxDelay)},
+
+		{key: "webhook-queue-dir", env: "WEBHOOK_QUEUE_DIR", usage: "directory persisting webhook subscriptions and pending deliveries", value: (*stringValue)(&c.WebhookQueueDir)},
+		{key: "webhook-queue-key", env: "WEBHOOK_QUEUE_KEY", usage: "key encrypting webhook secrets in the queue directory", value: (*stringValue)(&c.WebhookQueueKey), redact: redactAll, secret: true},
+		{key: "webhook-max-attempts", env: "WEBHOOK_MAX_ATTEMPTS", usage: "delivery attempts per webhook, 0 for the default", value: (*intValue)(&c.WebhookMaxAttempts)},
+		{key: "webhook-backoff", env: "WEBHOOK_BACKOFF", usage: "delay before the first webhook retry, 0 for the default", value: (*durationValue)(&c.WebhookBackoff)},
+
+		{key: "node-id", env: "NODE_ID", usage: "this node's id among the cluster peers", value: (*stringValue)(&c.NodeID)},
+		{key: "cluster-peers", env: "CLUSTER_PEERS", usage: "comma-separated id=url pairs for every cluster node", value: (*stringValue)(&c.ClusterPeers)},
+		{key: "cluster-secret", env: "CLUSTER_SECRET", usage: "shared secret authenticating cluster requests", value: (*stringValue)(&c.ClusterSecret), redact: redactAll, secret: true},
+		{key: "cluster-heartbeat", env: "CLUSTER_HEARTBEAT", usage: "interval between cluster heartbeats, 0 for the default", value: (*durationValue)(&c.ClusterHeartbeat)},
+
+		{key: "log-level", env: "LOG_LEVEL", usage: "debug, info, warn or error", value: (*levelValue)(&c.LogLevel)},
+		{key: "log-format", env: "LOG_FORMAT", usage: "text or json", value: (*stringValue)(&c.LogFormat)},
+		{key: "log-content", env: "LOG_CONTENT", usage: "include message content in logs", value: (*boolValue)(&c.LogContent)},
+
+		{key: "otlp-endpoint", env: "OTLP_ENDPOINT", usage: "OTLP/HTTP trace collector, host:port", value: (*stringValue)(&c.OTLPEndpoint)},
+		{key: "otlp-insecure", env: "OTLP_INSECURE", usage: "export traces without TLS", value: (*boolValue)(&c.OTLPInsecure)},
+		{key: "trace-sample-ratio", env: "TRACE_SAMPLE_RATIO", usage: "fraction of new traces sampled, from 0 to 1", value: (*floatValue)(&c.TraceSampleRatio)},
+	}
+}
+
+func redactAll(string) string { return redacted }
+
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return redacted
+	}
+	return u.Redacted()
+}
+
+// value is a flag.Value that can also report its typed value, so Print
+// writes numbers and lists rather than strings.
+type value interface {
+	String() string
+	Set(string) error
+	get() interface{}
+}
+
+type stringValue string
+
+func (v *stringValue) String() string     { return string(*v) }
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) get() interface{}   { return string(*v) }
+
+type intValue int
+
+func (v *intValue) String() string   { return strconv.Itoa(int(*v)) }
+func (v *intValue) get() interface{} { return int(*v) }
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return numError(err)
+	}
+	*v = intValue(n)
+	return nil
+}
+
+type boolValue bool
+
+func (v *boolValue) String() string   { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) get() interface{} { return bool(*v) }
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return numError(err)
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+type floatValue float64
+
+func (v *floatValue) String() string   { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+func (v *floatValue) get() interface{} { return float64(*v) }
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return numError(err)
+	}
+	*v = floatValue(f)
+	return nil
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) String() string   { return time.Duration(*v).String() }
+func (v *durationValue) get() interface{} { return v.String() }
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+type listValue []string
+
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+
+func (v *listValue) get() interface{} {
+	if *v == nil {
+		return []string{}
+	}
+	return []string(*v)
+}
+
+func (v *listValue) Set(s string) error {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*v = items
+	return nil
+}
+
+type levelValue slog.Level
+
+func (v *levelValue) String() string   { return slog.Level(*v).String() }
+func (v *levelValue) get() interface{} { return v.String() }
+
+func (v *levelValue) Set(s string) error {
+	return (*slog.Level)(v).UnmarshalText([]byte(s))
+}
+
+// numError drops strconv's function name and input, which the caller
+// reports itself.
+func numError(err error) error {
+	if numErr, ok := err.(*strconv.NumError); ok {
+		return numErr.Err
+	}
+	return err
+}
+
+// recorder stands in for a field on the command line, keeping what was set
+// so Load can apply flags after the file and the environment.
+type recorder struct {
+	field field
+	set   *[]flagValue
+}
+
+type flagValue struct {
+	field field
+	value string
+}
+
+func (r *recorder) String() string {
+	if r.field.value == nil {
+		return ""
+	}
+	return r.field.value.String()
+}
+
+func (r *recorder) Set(s string) error {
+	*r.set = append(*r.set, flagValue{field: r.field, value: s})
+	return nil
+}
+
+func (r *recorder) IsBoolFlag() bool {
+	b, ok := r.field.value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Validate reports every setting that is out of range or inconsistent with
+// another, naming each by its key.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{key}, args...)...))
+		}
+	}
+
+	check(c.Address != "", "address", "must be set")
+	for _, addr := range []struct{ key, value string }{
+		{"address", c.Address},
+		{"tcp-address", c.TCPAddress},
+		{"irc-address", c.IRCAddress},
+		{"grpc-address", c.GRPCAddress},
+		{"otlp-endpoint", c.OTLPEndpoint},
+	} {
+		if addr.value == "" {
+			continue
+		}
+		_, _, err := net.SplitHostPort(addr.value)
+		check(err == nil, addr.key, "%q is not a host:port address", addr.value)
+	}
+
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "tls-cert-file", "must be set together with tls-key-file")
+	check((c.GRPCTLSCertFile == "") == (c.GRPCTLSKeyFile == ""), "grpc-tls-cert-file", "must be set together with grpc-tls-key-file")
+	for _, file := range []struct{ key, value string }{
+		{"tls-cert-file", c.TLSCertFile},
+		{"tls-key-file", c.TLSKeyFile},
+		{"grpc-tls-cert-file", c.GRPCTLSCertFile},
+		{"grpc-tls-key-file", c.GRPCTLSKeyFile},
+	} {
+		if file.value == "" {
+			continue
+		}
+		_, err := os.Stat(file.value)
+		check(err == nil, file.key, "%v", err)
+	}
+
+	for _, n := range []struct {
+		key   string
+		value int
+	}{
+		{"history-size", c.HistorySize},
+		{"max-message-length", c.MaxMessageLength},
+		{"max-connections", c.MaxConnections},
+		{"ws-read-buffer-size", c.ReadBufferSize},
+		{"ws-write-buffer-size", c.WriteBufferSize},
+		{"ws-compression-threshold", c.CompressionThreshold},
+		{"ws-batch-max-messages", c.BatchMaxMessages},
+		{"webhook-max-attempts", c.WebhookMaxAttempts},
+	} {
+		check(n.value >= 0, n.key, "must not be negative, got %d", n.value)
+	}
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"poll-session-ttl", c.PollSessionTTL},
+		{"drain-period", c.DrainPeriod},
+		{"shutdown-timeout", c.ShutdownTimeout},
+		{"read-header-timeout", c.ReadHeaderTimeout},
+		{"ws-batch-max-delay", c.BatchMaxDelay},
+		{"webhook-backoff", c.WebhookBackoff},
+		{"cluster-heartbeat", c.ClusterHeartbeat},
+	} {
+		check(d.value >= 0, d.key, "must not be negative, got %s", d.value)
+	}
+
+	check(c.CompressionLevel >= -2 && c.CompressionLevel <= 9, "ws-compression-level", "must be from -2 to 9, got %d", c.CompressionLevel)
+	check(c.LogFormat == "text" || c.LogFormat == "json", "log-format", "must be text or json, got %q", c.LogFormat)
+	check(c.TraceSampleRatio >= 0 && c.TraceSampleRatio <= 1, "trace-sample-ratio", "must be from 0 to 1, got %g", c.TraceSampleRatio)
+	check(c.WebhookQueueDir == "" || c.WebhookQueueKey != "", "webhook-queue-key", "must be set when webhook-queue-dir is")
+	check(c.ClusterPeers == "" || c.NodeID != "", "node-id", "must be set when cluster-peers is")
+	check(c.ClusterPeers == "" || c.ClusterSecret != "", "cluster-secret", "must be set when cluster-peers is")
+
+	if c.RedisURL != "" {
+		// The parse error would repeat the URL, password included.
+		u, err := url.Parse(c.RedisURL)
+		check(err == nil, "redis-url", "is not a valid URL")
+		if err == nil {
+			check(u.Scheme == "redis" || u.Scheme == "rediss" || u.Scheme == "unix", "redis-url", "unsupported scheme %q", u.Scheme)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"chat/internal/chat"
+)
+
+func MaxLength(limit int) MessageFilter {
+	return Func(func(msg *chat.Message) Verdict {
+		if utf8.RuneCountInString(msg.Content) > limit {
+			return RejectMessage(fmt.Sprintf("message exceeds %d characters", limit))
+		}
+		return AllowMessage()
+	})
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|ftp://|www\.)\S+`)
+
+func BlockLinks() MessageFilter {
+	return Func(func(msg *chat.Message) Verdict {
+		if linkPattern.MatchString(msg.Content) {
+			return RejectMessage("links are not allowed")
+		}
+		return AllowMessage()
+	})
+}
+
+// BannedWords masks every match of its patterns with asterisks.
+type BannedWords struct {
+	patterns []*regexp.Regexp
+}
+
+// NewBannedWords compiles a word list. Entries wrapped in slashes, such as
+// /sp[a4]m/, are regular expressions; anything else matches as a whole word,
+// ignoring case.
+func NewBannedWords(entries []string) (*BannedWords, error) {
+	bw := &BannedWords{}
+	for _, entry := range entries {
+		var expr string
+		if len(entry) > 1 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+			expr = entry[1 : len(entry)-1]
+		} else {
+			expr = `(?i)\b` + regexp.QuoteMeta(entry) + `\b`
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("banned word %q: %w", entry, err)
+		}
+		bw.patterns = append(bw.patterns, pattern)
+	}
+	return bw, nil
+}
+
+// LoadBannedWords reads one entry per line from path, skipping blank lines and
+// lines starting with #.
+func LoadBannedWords(path string) (*BannedWords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewBannedWords(entries)
+}
+
+func (bw *BannedWords) Filter(msg *chat.Message) Verdict {
+	content := msg.Content
+	for _, pattern := range bw.patterns {
+		content = pattern.ReplaceAllStringFunc(content, func(match string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(match))
+		})
+	}
+	if content != msg.Content {
+		return RewriteMessage(content)
+	}
+	return AllowMessage()
+}
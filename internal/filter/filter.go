@@ -0,0 +1,88 @@
+package filter
+
+import "chat/internal/chat"
+
+type Action int
+
+const (
+	// Allow passes the message on unchanged.
+	Allow Action = iota
+	// Rewrite replaces the message content with Verdict.Content.
+	Rewrite
+	// Reject refuses the message and tells the sender why.
+	Reject
+	// Drop discards the message silently: only the sender sees it.
+	Drop
+)
+
+func (a Action) String() string {
+	switch a {
+	case Allow:
+		return "allow"
+	case Rewrite:
+		return "rewrite"
+	case Reject:
+		return "reject"
+	case Drop:
+		return "drop"
+	default:
+		return "unknown"
+	}
+}
+
+type Verdict struct {
+	Action  Action
+	Content string
+	Reason  string
+}
+
+// MessageFilter inspects an inbound chat message before it is broadcast.
+type MessageFilter interface {
+	Filter(msg *chat.Message) Verdict
+}
+
+// Func adapts an ordinary function to the MessageFilter interface.
+type Func func(msg *chat.Message) Verdict
+
+func (f Func) Filter(msg *chat.Message) Verdict {
+	return f(msg)
+}
+
+func AllowMessage() Verdict {
+	return Verdict{Action: Allow}
+}
+
+func RewriteMessage(content string) Verdict {
+	return Verdict{Action: Rewrite, Content: content}
+}
+
+func RejectMessage(reason string) Verdict {
+	return Verdict{Action: Reject, Reason: reason}
+}
+
+func DropMessage(reason string) Verdict {
+	return Verdict{Action: Drop, Reason: reason}
+}
+
+// Chain runs filters in order. Rewrites are applied to the message before the
+// next filter sees it; the first Reject or Drop stops the chain.
+type Chain []MessageFilter
+
+func (c Chain) Run(msg *chat.Message) Verdict {
+	rewritten := false
+	for _, f := range c {
+		verdict := f.Filter(msg)
+		switch verdict.Action {
+		case Rewrite:
+			msg.Content = verdict.Content
+			rewritten = true
+		case Reject, Drop:
+			return verdict
+		}
+	}
+
+	if rewritten {
+		return RewriteMessage(msg.Content)
+	}
+	return AllowMessage()
+}
@@ -0,0 +1,42 @@
+package grpcapi
+
+import (
+	"context"
+	"strings"
+
+	"chat/internal/grpcapi/chatv1"
+	"chat/internal/server"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// protectedMethods change rooms, and are only served to callers bearing an
+// API key.
+var protectedMethods = map[string]bool{
+	chatv1.Chat_CreateRoom_FullMethodName: true,
+	chatv1.Chat_UpdateRoom_FullMethodName: true,
+	chatv1.Chat_DeleteRoom_FullMethodName: true,
+}
+
+// requireAPIKey is the gRPC counterpart of the HTTP API's key check. The key
+// is sent as "authorization: Bearer <key>" metadata.
+func requireAPIKey(chatServer *server.Server) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if protectedMethods[info.FullMethod] && !chatServer.ValidAPIKey(bearerToken(ctx)) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or missing API key")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func bearerToken(ctx context.Context) string {
+	for _, value := range metadata.ValueFromIncomingContext(ctx, "authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
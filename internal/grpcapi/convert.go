@@ -0,0 +1,100 @@
+package grpcapi
+
+import (
+	"time"
+
+	"chat/internal/chat"
+	"chat/internal/grpcapi/chatv1"
+	"chat/internal/server"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func timestampToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func timestampFromProto(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func roomInfoToProto(info chat.RoomInfo) *chatv1.RoomInfo {
+	return &chatv1.RoomInfo{
+		Id:          info.ID,
+		Title:       info.Title,
+		Topic:       info.Topic,
+		Description: info.Description,
+		Visibility:  info.Visibility,
+		CreatedAt:   timestampToProto(info.CreatedAt),
+		CreatedBy:   info.CreatedBy,
+		Attributes:  info.Attributes,
+	}
+}
+
+func roomInfoFromProto(info *chatv1.RoomInfo) chat.RoomInfo {
+	return chat.RoomInfo{
+		ID:          info.GetId(),
+		Title:       info.GetTitle(),
+		Topic:       info.GetTopic(),
+		Description: info.GetDescription(),
+		Visibility:  info.GetVisibility(),
+		CreatedAt:   timestampFromProto(info.GetCreatedAt()),
+		CreatedBy:   info.GetCreatedBy(),
+		Attributes:  info.GetAttributes(),
+	}
+}
+
+func roomSummaryToProto(summary chat.RoomSummary) *chatv1.RoomSummary {
+	return &chatv1.RoomSummary{
+		Info:         roomInfoToProto(summary.RoomInfo),
+		Members:      int32(summary.Members),
+		LastActivity: timestampToProto(summary.LastActivity),
+	}
+}
+
+func roomPageToProto(page server.RoomPage) *chatv1.RoomPage {
+	rooms := make([]*chatv1.RoomSummary, 0, len(page.Rooms))
+	for _, summary := range page.Rooms {
+		rooms = append(rooms, roomSummaryToProto(summary))
+	}
+	return &chatv1.RoomPage{Rooms: rooms, NextCursor: page.NextCursor}
+}
+
+func roomQueryFromProto(query *chatv1.RoomQuery) server.RoomQuery {
+	return server.RoomQuery{
+		Search:     query.GetQ(),
+		Sort:       query.GetSort(),
+		Visibility: query.GetVisibility(),
+		Limit:      int(query.GetLimit()),
+		Cursor:     query.GetCursor(),
+	}
+}
+
+func roomUpdateFromProto(update *chatv1.RoomUpdate) chat.RoomUpdate {
+	return chat.RoomUpdate{
+		Title:       update.Title,
+		Topic:       update.Topic,
+		Description: update.Description,
+		Visibility:  update.Visibility,
+		Attributes:  update.GetAttributes(),
+	}
+}
+
+func messageToProto(msg *chat.Message) *chatv1.Message {
+	return &chatv1.Message{
+		Id:        msg.ID,
+		Seq:       msg.Seq,
+		Type:      msg.Type,
+		Room:      msg.Room,
+		Content:   msg.Content,
+		Sender:    msg.Sender,
+		Bot:       msg.Bot,
+		Timestamp: timestampToProto(msg.Timestamp),
+	}
+}
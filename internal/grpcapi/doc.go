@@ -0,0 +1,10 @@
+// Package grpcapi serves the chat over gRPC as the chat.v1.Chat service, whose
+// schema is chatv1/chat.proto. Clients generated from it by protoc talk to the
+// server with the standard protobuf codec.
+//
+// On the Chat stream, the frame field of ClientFrame and ServerFrame holds
+// exactly the JSON frame a WebSocket client would send or receive, such as
+// {"type":"join","room":"lobby"}.
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative chatv1/chat.proto
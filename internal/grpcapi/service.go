@@ -0,0 +1,110 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"chat/internal/grpcapi/chatv1"
+	"chat/internal/server"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type service struct {
+	chatv1.UnimplementedChatServer
+	chat *server.Server
+}
+
+// NewServer returns a gRPC server exposing chatServer's rooms. gRPC clients
+// join the same rooms, under the same names, as WebSocket and other clients.
+// The methods that change rooms require an API key, as on the HTTP API.
+func NewServer(chatServer *server.Server, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(requireAPIKey(chatServer)))
+	grpcServer := grpc.NewServer(opts...)
+	chatv1.RegisterChatServer(grpcServer, &service{chat: chatServer})
+	return grpcServer
+}
+
+func (s *service) Chat(stream chatv1.Chat_ChatServer) error {
+	var remoteAddr string
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remoteAddr = p.Addr.String()
+	}
+	if err := s.chat.ServeTransport(newStreamTransport(stream), remoteAddr); err != nil {
+		return statusError(err)
+	}
+	return nil
+}
+
+func (s *service) CreateRoom(ctx context.Context, req *chatv1.CreateRoomRequest) (*chatv1.RoomInfo, error) {
+	info, err := s.chat.CreateRoom(roomInfoFromProto(req.GetRoom()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return roomInfoToProto(info), nil
+}
+
+func (s *service) GetRoom(ctx context.Context, req *chatv1.GetRoomRequest) (*chatv1.RoomSummary, error) {
+	summary, err := s.chat.GetRoom(req.GetId())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return roomSummaryToProto(summary), nil
+}
+
+func (s *service) ListRooms(ctx context.Context, req *chatv1.ListRoomsRequest) (*chatv1.RoomPage, error) {
+	query := roomQueryFromProto(req.GetQuery())
+	if query.IncludesPrivate() && !s.chat.ValidAPIKey(bearerToken(ctx)) {
+		return nil, status.Error(codes.Unauthenticated, "listing private rooms requires an API key")
+	}
+	page, err := s.chat.ListRooms(query)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return roomPageToProto(page), nil
+}
+
+func (s *service) UpdateRoom(ctx context.Context, req *chatv1.UpdateRoomRequest) (*chatv1.RoomInfo, error) {
+	info, err := s.chat.UpdateRoom(req.GetId(), roomUpdateFromProto(req.GetUpdate()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return roomInfoToProto(info), nil
+}
+
+func (s *service) DeleteRoom(ctx context.Context, req *chatv1.DeleteRoomRequest) (*chatv1.DeleteRoomResponse, error) {
+	if err := s.chat.DeleteRoom(req.GetId()); err != nil {
+		return nil, statusError(err)
+	}
+	return &chatv1.DeleteRoomResponse{}, nil
+}
+
+func (s *service) History(ctx context.Context, req *chatv1.HistoryRequest) (*chatv1.HistoryResponse, error) {
+	messages, err := s.chat.History(ctx, req.GetRoom(), req.GetAfterSeq(), int(req.GetLimit()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	resp := &chatv1.HistoryResponse{Messages: make([]*chatv1.Message, 0, len(messages))}
+	for _, msg := range messages {
+		resp.Messages = append(resp.Messages, messageToProto(msg))
+	}
+	return resp, nil
+}
+
+func statusError(err error) error {
+	switch {
+	case errors.Is(err, server.ErrRoomNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, server.ErrRoomExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, server.ErrInvalidArgument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, server.ErrReadOnly), errors.Is(err, server.ErrDraining):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
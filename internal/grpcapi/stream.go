@@ -0,0 +1,74 @@
+package grpcapi
+
+import (
+	"io"
+	"sync"
+
+	"chat/internal/grpcapi/chatv1"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streamTransport carries chat frames over a Chat stream. Recv cannot be
+// interrupted, so frames are received on their own goroutine and Close only
+// has to release the reader; the stream itself ends when the handler returns.
+type streamTransport struct {
+	stream    chatv1.Chat_ChatServer
+	frames    chan []byte
+	err       error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newStreamTransport(stream chatv1.Chat_ChatServer) *streamTransport {
+	t := &streamTransport{
+		stream: stream,
+		frames: make(chan []byte),
+		done:   make(chan struct{}),
+	}
+	go t.receive()
+	return t
+}
+
+func (t *streamTransport) receive() {
+	defer close(t.frames)
+	for {
+		frame, err := t.stream.Recv()
+		if err != nil {
+			t.err = err
+			return
+		}
+		select {
+		case t.frames <- frame.GetFrame():
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *streamTransport) ReadMessage() ([]byte, error) {
+	select {
+	case frame, ok := <-t.frames:
+		if ok {
+			return frame, nil
+		}
+		if t.err == nil || t.err == io.EOF || status.Code(t.err) == codes.Canceled {
+			return nil, io.EOF
+		}
+		return nil, t.err
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+func (t *streamTransport) WriteMessage(message []byte) error {
+	return t.stream.Send(&chatv1.ServerFrame{Frame: message})
+}
+
+func (t *streamTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+	return nil
+}
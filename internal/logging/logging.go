@@ -0,0 +1,69 @@
+// Package logging sets up the server's structured logger and names the
+// attributes that let one session be followed through the logs.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Attribute keys shared by every log line that concerns a connection, a user
+// or a room.
+const (
+	KeyConn    = "conn_id"
+	KeyUser    = "user_id"
+	KeyRoom    = "room_id"
+	KeyRemote  = "remote_addr"
+	KeyContent = "content"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+const redacted = "[redacted]"
+
+type Options struct {
+	Level  slog.Level
+	Format string
+
+	// LogContent writes message content as is. By default it is replaced
+	// with a placeholder.
+	LogContent bool
+}
+
+// New returns a logger writing to w in the given format.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+	if !opts.LogContent {
+		handlerOpts.ReplaceAttr = redactContent
+	}
+
+	switch opts.Format {
+	case FormatText, "":
+		return slog.New(slog.NewTextHandler(w, handlerOpts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, handlerOpts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+}
+
+func redactContent(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == KeyContent {
+		return slog.String(KeyContent, redacted)
+	}
+	return a
+}
+
+func Room(id string) slog.Attr {
+	return slog.String(KeyRoom, id)
+}
+
+// Content attaches message content to a log line. Loggers built by New
+// redact it unless LogContent is set.
+func Content(content []byte) slog.Attr {
+	return slog.String(KeyContent, string(content))
+}
@@ -0,0 +1,85 @@
+// Package metrics holds the process-wide Prometheus collectors shared by the
+// chat core and the server. Per-server gauges, such as the number of rooms,
+// are collected by the server itself; see Server.MetricsHandler.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "chat"
+
+// Registry holds every collector in this package plus the Go runtime and
+// process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	MessagesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Frames received from clients, by frame type.",
+	}, []string{"type"})
+
+	MessagesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_sent_total",
+		Help:      "Frames written to clients, by frame type.",
+	}, []string{"type"})
+
+	ErrorFrames = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "error_frames_sent_total",
+		Help:      "Error frames written to clients.",
+	})
+
+	BroadcastFanout = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "broadcast_fanout_seconds",
+		Help:      "Time taken to queue a broadcast for every member of a room.",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+	})
+
+	SendQueueDepth = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "send_queue_depth",
+		Help:      "Frames waiting in a connection's send queue, sampled on every enqueue.",
+		Buckets:   []float64{0, 1, 2, 4, 8, 16, 32, 64, 128, 256},
+	})
+
+	SlowConsumerDrops = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slow_consumer_drops_total",
+		Help:      "Members disconnected because their send queue was full.",
+	})
+
+	BackplaneDrops = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backplane_drops_total",
+		Help:      "Frames from other nodes dropped because the room's queue was full.",
+	})
+
+	UpgradeFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_upgrade_failures_total",
+		Help:      "WebSocket handshakes that failed.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		MessagesReceived,
+		MessagesSent,
+		ErrorFrames,
+		BroadcastFanout,
+		SendQueueDepth,
+		SlowConsumerDrops,
+		BackplaneDrops,
+		UpgradeFailures,
+	)
+}
+
+// MemberBuckets are the upper bounds of the chat_room_members histogram.
+var MemberBuckets = []float64{0, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 5000, 10000}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"chat/internal/chat"
+	"chat/internal/command"
+	"chat/internal/logging"
+
+	"github.com/gorilla/mux"
+)
+
+var ErrConnectionNotFound = errors.New("connection not found")
+
+// ConnectionInfo describes a connected client for the admin API.
+type ConnectionInfo struct {
+	ID          string    `json:"id"`
+	RemoteAddr  string    `json:"remote_addr,omitempty"`
+	User        string    `json:"user"`
+	Bot         bool      `json:"bot,omitempty"`
+	Rooms       []string  `json:"rooms"`
+	QueueDepth  int       `json:"queue_depth"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+func connectionInfo(participant *chat.ChatParticipant) ConnectionInfo {
+	rooms := participant.RoomIDs()
+	sort.Strings(rooms)
+	return ConnectionInfo{
+		ID:          participant.Conn.ID(),
+		RemoteAddr:  participant.Conn.RemoteAddr(),
+		User:        participant.Name(),
+		Bot:         participant.Bot,
+		Rooms:       rooms,
+		QueueDepth:  participant.Conn.QueueDepth(),
+		ConnectedAt: participant.Conn.ConnectedAt(),
+	}
+}
+
+// Connections lists every connected client, oldest first.
+func (s *Server) Connections() []ConnectionInfo {
+	s.participantsMu.Lock()
+	connections := make([]ConnectionInfo, 0, len(s.participants))
+	for participant := range s.participants {
+		connections = append(connections, connectionInfo(participant))
+	}
+	s.participantsMu.Unlock()
+
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].ConnectedAt.Before(connections[j].ConnectedAt)
+	})
+	return connections
+}
+
+// Disconnect closes the connection with the given ID. The client leaves its
+// rooms as if it had hung up; a bot is stopped for good.
+func (s *Server) Disconnect(connID string) error {
+	s.participantsMu.Lock()
+	var target *chat.ChatParticipant
+	for participant := range s.participants {
+		if participant.Conn.ID() == connID {
+			target = participant
+			break
+		}
+	}
+	s.participantsMu.Unlock()
+
+	if target == nil {
+		return ErrConnectionNotFound
+	}
+	if target.Bot && s.stopBot(target) {
+		return nil
+	}
+	target.Conn.Close()
+	return nil
+}
+
+// RoomConnections lists the members of a room with their connection details.
+func (s *Server) RoomConnections(roomID string) ([]ConnectionInfo, error) {
+	room, exists := s.lookupRoom(roomID)
+	if !exists {
+		return nil, ErrRoomNotFound
+	}
+
+	members := room.Members()
+	connections := make([]ConnectionInfo, 0, len(members))
+	for _, member := range members {
+		connections = append(connections, connectionInfo(member))
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].User < connections[j].User
+	})
+	return connections, nil
+}
+
+// Announce sends a system message to every room on this server and returns
+// the number of rooms it reached.
+func (s *Server) Announce(content string) int {
+	count := 0
+	s.rooms.Range(func(room *chat.Room) bool {
+		room.Broadcast(chat.NewEvent(command.EventSystem, room.ID, map[string]string{"content": content}))
+		count++
+		return true
+	})
+	return count
+}
+
+// SetReadOnly toggles maintenance mode, in which messages are refused and
+// rooms cannot be created, changed or deleted. Clients stay connected and
+// can still join existing rooms and read history.
+func (s *Server) SetReadOnly(readOnly bool) {
+	s.readOnly.Store(readOnly)
+}
+
+func (s *Server) ReadOnly() bool {
+	return s.readOnly.Load()
+}
+
+// writable returns ErrReadOnly in maintenance mode.
+func (s *Server) writable() error {
+	if s.ReadOnly() {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+func (s *Server) adminRoutes() {
+	admin := s.router.PathPrefix("/admin").Subrouter()
+	admin.Use(s.requireAdmin)
+	admin.HandleFunc("/connections", s.handleAdminConnections).Methods("GET")
+	admin.HandleFunc("/connections/{connID}", s.handleAdminDisconnect).Methods("DELETE")
+	admin.HandleFunc("/rooms/{roomID}/members", s.handleAdminMembers).Methods("GET")
+	admin.HandleFunc("/announcements", s.handleAdminAnnouncement).Methods("POST")
+	admin.HandleFunc("/maintenance", s.handleAdminMaintenance).Methods("GET")
+	admin.HandleFunc("/maintenance", s.handleAdminSetMaintenance).Methods("PUT")
+}
+
+// requireAdmin only lets through requests bearing one of the configured admin
+// keys. Without any, the admin API is closed.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if matchKey(s.config.AdminKeys, bearerToken(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chat-admin"`)
+		http.Error(w, "Invalid or missing admin key", http.StatusUnauthorized)
+	})
+}
+
+func (s *Server) handleAdminConnections(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Connections())
+}
+
+func (s *Server) handleAdminDisconnect(w http.ResponseWriter, r *http.Request) {
+	connID := mux.Vars(r)["connID"]
+	if err := s.Disconnect(connID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	requestLogger(r).Warn("Connection closed by admin", logging.KeyConn, connID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAdminMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := s.RoomConnections(mux.Vars(r)["roomID"])
+	if err != nil {
+		http.Error(w, err.Error(), apiErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+type announcementRequest struct {
+	Content string `json:"content"`
+}
+
+func (s *Server) handleAdminAnnouncement(w http.ResponseWriter, r *http.Request) {
+	var req announcementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Content) == "" {
+		http.Error(w, "Announcement content is required", http.StatusBadRequest)
+		return
+	}
+
+	rooms := s.Announce(req.Content)
+	requestLogger(r).Warn("Announcement sent by admin", "rooms", rooms)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"rooms": rooms})
+}
+
+type maintenanceState struct {
+	ReadOnly bool `json:"read_only"`
+}
+
+func (s *Server) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenanceState{ReadOnly: s.ReadOnly()})
+}
+
+func (s *Server) handleAdminSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var state maintenanceState
+	if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+		http.Error(w, "Invalid maintenance state", http.StatusBadRequest)
+		return
+	}
+
+	s.SetReadOnly(state.ReadOnly)
+	requestLogger(r).Warn("Maintenance mode changed by admin", "read_only", state.ReadOnly)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"chat/internal/chat"
+	"chat/internal/logging"
+	"chat/internal/webhook"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+var (
+	ErrRoomExists   = errors.New("room already exists")
+	ErrRoomNotFound = errors.New("room not found")
+
+	// ErrInvalidArgument is matched by every validation error returned from
+	// the room API, whatever its message.
+	ErrInvalidArgument = errors.New("invalid argument")
+
+	// ErrReadOnly is returned for messages and room changes while the server
+	// is in maintenance mode.
+	ErrReadOnly = errors.New("server is in read-only maintenance mode")
+
+	// ErrDraining is returned for new sessions once the server has started
+	// draining for shutdown.
+	ErrDraining = errors.New("server is shutting down")
+)
+
+type argumentError struct {
+	reason string
+}
+
+func (e *argumentError) Error() string {
+	return e.reason
+}
+
+func (e *argumentError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+func invalidArgument(reason string) error {
+	return &argumentError{reason: reason}
+}
+
+// CreateRoom registers a new room with the given metadata. CreatedAt and an
+// empty visibility are filled in with their defaults.
+func (s *Server) CreateRoom(info chat.RoomInfo) (chat.RoomInfo, error) {
+	if s.ReadOnly() {
+		return chat.RoomInfo{}, ErrReadOnly
+	}
+	if info.ID == "" {
+		return chat.RoomInfo{}, invalidArgument("room ID is required")
+	}
+	if info.Visibility != "" && !validVisibility(info.Visibility) {
+		return chat.RoomInfo{}, invalidArgument("visibility must be public or private")
+	}
+
+	room, created := s.rooms.GetOrCreate(info.ID, func() *chat.Room {
+		return s.startRoom(info)
+	})
+	if !created {
+		return chat.RoomInfo{}, ErrRoomExists
+	}
+
+	info = room.Info()
+	s.emit(webhook.EventRoomCreated, info.ID, info)
+	return info, nil
+}
+
+func (s *Server) GetRoom(roomID string) (chat.RoomSummary, error) {
+	room, exists := s.lookupRoom(roomID)
+	if !exists {
+		return chat.RoomSummary{}, ErrRoomNotFound
+	}
+	return room.Summary(), nil
+}
+
+func (s *Server) ListRooms(query RoomQuery) (RoomPage, error) {
+	q, err := query.compile()
+	if err != nil {
+		return RoomPage{}, err
+	}
+
+	rooms := make([]chat.RoomSummary, 0, s.rooms.Len())
+	s.rooms.Range(func(room *chat.Room) bool {
+		rooms = append(rooms, room.Summary())
+		return true
+	})
+
+	return listRooms(rooms, q), nil
+}
+
+// UpdateRoom applies update to the room and notifies its members.
+func (s *Server) UpdateRoom(roomID string, update chat.RoomUpdate) (chat.RoomInfo, error) {
+	if update.Visibility != nil && !validVisibility(*update.Visibility) {
+		return chat.RoomInfo{}, invalidArgument("visibility must be public or private")
+	}
+	room, exists := s.lookupRoom(roomID)
+	if !exists {
+		return chat.RoomInfo{}, ErrRoomNotFound
+	}
+	return s.updateRoom(room, update)
+}
+
+// DeleteRoom removes the room from the registry along with its history and
+// webhook subscriptions, so a room later created under the same ID starts
+// afresh. Members receive a room_deleted event and are taken out of the room;
+// their connections stay open.
+func (s *Server) DeleteRoom(roomID string) error {
+	if s.ReadOnly() {
+		return ErrReadOnly
+	}
+	room, exists := s.rooms.Delete(roomID)
+	if !exists {
+		return ErrRoomNotFound
+	}
+	s.mu.Lock()
+	delete(s.ingestTokens, roomID)
+	s.mu.Unlock()
+
+	// Joins that found the room before it was unregistered either finish
+	// before Close returns, and are told below, or are turned away.
+	room.Close()
+	info := room.Info()
+	room.Broadcast(chat.NewEvent(chat.EventRoomDeleted, roomID, info))
+	for _, member := range room.Members() {
+		member.ExitRoom(room)
+	}
+	room.Stop()
+
+	s.emit(webhook.EventRoomDeleted, roomID, info)
+	s.webhooks.UnsubscribeRoom(roomID)
+	if err := s.store.Delete(context.Background(), roomID); err != nil {
+		slog.Error("Error deleting room history", logging.Room(roomID), "error", err)
+	}
+	s.handoffs.Delete(roomID)
+	slog.Info("Room deleted", logging.Room(roomID))
+	return nil
+}
+
+// History returns up to limit messages of the room with a sequence number
+// greater than afterSeq, oldest first.
+func (s *Server) History(ctx context.Context, roomID string, afterSeq uint64, limit int) ([]*chat.Message, error) {
+	if _, exists := s.lookupRoom(roomID); !exists && s.cluster == nil {
+		return nil, ErrRoomNotFound
+	}
+	switch {
+	case limit < 0:
+		return nil, invalidArgument("limit must be a positive integer")
+	case limit == 0:
+		limit = defaultHistoryLimit
+	case limit > maxHistoryLimit:
+		limit = maxHistoryLimit
+	}
+	return s.since(ctx, roomID, afterSeq, limit)
+}
+
+// ServeTransport runs a chat session over transport, speaking the same JSON
+// frames as the WebSocket endpoint. It blocks until the session ends.
+// remoteAddr identifies the client in logs. It returns ErrDraining at once,
+// without reading from transport, if the server is draining.
+func (s *Server) ServeTransport(transport chat.Transport, remoteAddr string) error {
+	if s.Draining() {
+		return ErrDraining
+	}
+	participant := s.newParticipant(chat.NewTransportConnection(transport), remoteAddr)
+	s.handleParticipant(participant)
+	return nil
+}
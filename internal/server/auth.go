@@ -0,0 +1,42 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// matchKey reports whether token is one of keys, in constant time per key.
+func matchKey(keys []string, token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidAPIKey reports whether token is one of the configured API or admin
+// keys.
+func (s *Server) ValidAPIKey(token string) bool {
+	return matchKey(s.config.APIKeys, token) || matchKey(s.config.AdminKeys, token)
+}
+
+// requireAPIKey only lets through requests bearing one of the configured API
+// or admin keys. Without any, the routes it guards are closed.
+func (s *Server) requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.ValidAPIKey(bearerToken(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		unauthorized(w)
+	})
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="chat"`)
+	http.Error(w, "Invalid or missing API key", http.StatusUnauthorized)
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"chat/internal/bot"
+	"chat/internal/chat"
+	"chat/internal/logging"
+)
+
+const botHandleTimeout = 10 * time.Second
+
+var errBotStopped = errors.New("bot has been stopped")
+
+// WithBots registers in-process bots. Each bot becomes a room member flagged
+// as a bot and receives the events of the rooms it joins.
+func WithBots(bots ...bot.Bot) Option {
+	return func(s *Server) {
+		s.bots = append(s.bots, bots...)
+	}
+}
+
+func (s *Server) startBots() {
+	for _, b := range s.bots {
+		if err := s.startBot(b); err != nil {
+			slog.Error("Error starting bot", "bot", b.Name(), "error", err)
+		}
+	}
+}
+
+func (s *Server) startBot(b bot.Bot) error {
+	participant, err := s.newBotParticipant(b.Name())
+	if err != nil {
+		return err
+	}
+	api := &botAPI{server: s, participant: participant, stopped: make(chan struct{})}
+	s.botAPIs = append(s.botAPIs, api)
+	go s.runBot(b, api)
+	return b.Init(api)
+}
+
+// newBotParticipant connects a bot under its name, which follows the same
+// rules as a nick and must not be taken by another member.
+func (s *Server) newBotParticipant(name string) (*chat.ChatParticipant, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	participant := chat.NewChatParticipant(chat.NewLocalConnection())
+	participant.Bot = true
+	if !s.trackNamed(participant, name) {
+		return nil, errNameInUse
+	}
+	return participant, nil
+}
+
+func (s *Server) runBot(b bot.Bot, api *botAPI) {
+	for {
+		participant := api.member()
+		select {
+		case <-participant.Conn.Done():
+			if api.isStopped() {
+				s.removeBot(participant)
+				return
+			}
+			if !s.reattachBot(api, participant) {
+				return
+			}
+		case frame := <-participant.Conn.Messages():
+			ev, ok := botEvent(participant.Name(), frame.Payload())
+			if !ok {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), botHandleTimeout)
+			if err := b.Handle(ctx, ev); err != nil {
+				slog.Error("Bot failed to handle event", "bot", b.Name(), "type", ev.Type, logging.Room(ev.Room), "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// reattachBot replaces a bot's connection after the room fan-out dropped it
+// for falling behind, and puts the bot back in the rooms it was in. The other
+// members never saw it leave, so it rejoins without a join event; the events
+// it missed are lost. If someone took the bot's name in the meantime, the bot
+// is stopped instead and reattachBot reports false.
+func (s *Server) reattachBot(api *botAPI, old *chat.ChatParticipant) bool {
+	rooms := old.RoomIDs()
+	slog.Warn("Bot fell behind and was dropped; reattaching it", "bot", old.Name(), "rooms", len(rooms))
+
+	s.untrackParticipant(old)
+	participant, err := s.newBotParticipant(old.Name())
+	if err != nil {
+		slog.Error("Error reattaching bot; stopping it", "bot", old.Name(), "error", err)
+		api.stop()
+		s.removeBot(old)
+		return false
+	}
+	for _, roomID := range rooms {
+		room, ok := old.Room(roomID)
+		old.LeaveRoom(roomID)
+		if !ok {
+			continue
+		}
+		if room.Owner() == old.Conn.ID() {
+			room.SetOwner(participant.Conn.ID())
+		}
+		participant.JoinRoom(room)
+	}
+	api.attach(participant)
+	return true
+}
+
+// removeBot takes a stopped bot out of its rooms the way a client that hangs
+// up leaves them.
+func (s *Server) removeBot(participant *chat.ChatParticipant) {
+	for _, roomID := range participant.RoomIDs() {
+		s.leaveRoom(participant, roomID)
+	}
+	s.untrackParticipant(participant)
+	slog.Info("Bot stopped", "bot", participant.Name())
+}
+
+// stopBot stops the bot whose current participant is participant. It reports
+// false if participant belongs to no bot.
+func (s *Server) stopBot(participant *chat.ChatParticipant) bool {
+	for _, api := range s.botAPIs {
+		if api.member() == participant {
+			api.stop()
+			return true
+		}
+	}
+	return false
+}
+
+// botEvent translates a room frame into a bot event. Frames the bot sent
+// itself and frame types bots do not subscribe to are skipped.
+func botEvent(name string, frame []byte) (bot.Event, bool) {
+	var envelope struct {
+		Type string          `json:"type"`
+		Room string          `json:"room"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(frame, &envelope); err != nil {
+		return bot.Event{}, false
+	}
+
+	ev := bot.Event{Room: envelope.Room, Time: time.Now()}
+	switch envelope.Type {
+	case "chat":
+		msg, err := chat.ParseMessage(frame)
+		if err != nil || msg.Sender == name {
+			return ev, false
+		}
+		ev.Type = bot.EventMessage
+		if strings.Contains(msg.Content, "@"+name) {
+			ev.Type = bot.EventMention
+		}
+		ev.Name = msg.Sender
+		ev.Message = msg
+		ev.Time = msg.Timestamp
+	case chat.EventJoin, chat.EventLeave:
+		var member chat.MemberInfo
+		if err := json.Unmarshal(envelope.Data, &member); err != nil || member.Name == name {
+			return ev, false
+		}
+		ev.Type = envelope.Type
+		ev.Name = member.Name
+	default:
+		return ev, false
+	}
+	return ev, true
+}
+
+type botAPI struct {
+	server *Server
+
+	mu          sync.Mutex
+	participant *chat.ChatParticipant
+
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// stop ends the bot: its connection is closed and runBot removes it instead
+// of reattaching it.
+func (api *botAPI) stop() {
+	api.stopOnce.Do(func() {
+		close(api.stopped)
+	})
+	api.member().Conn.Close()
+}
+
+func (api *botAPI) isStopped() bool {
+	select {
+	case <-api.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+func (api *botAPI) member() *chat.ChatParticipant {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return api.participant
+}
+
+func (api *botAPI) attach(participant *chat.ChatParticipant) {
+	api.mu.Lock()
+	api.participant = participant
+	api.mu.Unlock()
+}
+
+func (api *botAPI) Join(roomID string) error {
+	if roomID == "" {
+		return errors.New("room is required")
+	}
+	if api.isStopped() {
+		return errBotStopped
+	}
+	_, err := api.server.joinRoom(api.member(), roomID)
+	return err
+}
+
+func (api *botAPI) Leave(roomID string) {
+	api.server.leaveRoom(api.member(), roomID)
+}
+
+func (api *botAPI) Send(roomID, content string) (string, error) {
+	room, err := api.room(roomID)
+	if err != nil {
+		return "", err
+	}
+	return api.server.postMessage(context.Background(), api.member(), room, &chat.Message{Content: content, Timestamp: time.Now()})
+}
+
+func (api *botAPI) React(roomID, messageID, emoji string) error {
+	if err := api.server.writable(); err != nil {
+		return err
+	}
+	room, err := api.room(roomID)
+	if err != nil {
+		return err
+	}
+	room.Broadcast(chat.NewEvent(chat.EventReaction, roomID, map[string]string{
+		"message_id": messageID,
+		"emoji":      emoji,
+		"sender":     api.member().Name(),
+	}))
+	return nil
+}
+
+func (api *botAPI) Kick(roomID, name, reason string) error {
+	if err := api.server.writable(); err != nil {
+		return err
+	}
+	room, err := api.room(roomID)
+	if err != nil {
+		return err
+	}
+	return api.server.kickMember(room, name, reason, api.member().Name())
+}
+
+func (api *botAPI) room(roomID string) (*chat.Room, error) {
+	participant := api.member()
+	room, joined := participant.Room(roomID)
+	if !joined {
+		return nil, fmt.Errorf("bot %s is not in room %s", participant.Name(), roomID)
+	}
+	return room, nil
+}
@@ -0,0 +1,391 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"chat/internal/chat"
+	"chat/internal/cluster"
+	"chat/internal/logging"
+	"chat/internal/tracing"
+	"chat/internal/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	catchUpTimeout       = time.Second
+	replicationTimeout   = 2 * time.Second
+	replicationQueueSize = 1024
+	replicationBatchSize = 100
+)
+
+// WithCluster places the server in a cluster. Each room is owned by one node,
+// which numbers, stores and broadcasts its messages; the other nodes forward
+// to it. The owner replicates every message to the node next in line, and a
+// node taking a room over catches up from its peers first, so numbering and
+// history survive ownership moving. Broadcasts reach members on other nodes
+// through the backplane, so a cluster needs WithBackplane as well.
+func WithCluster(c *cluster.Cluster) Option {
+	return func(s *Server) {
+		s.cluster = c
+		s.node = c.Self().ID
+		s.replicas = newReplicator(c)
+	}
+}
+
+func (s *Server) startCluster(ctx context.Context) {
+	if s.cluster == nil {
+		return
+	}
+	if s.backplane == nil {
+		slog.Warn("Cluster configured without a backplane; members only see messages of rooms owned by their node")
+	}
+	go s.cluster.Run(ctx)
+}
+
+// publish numbers, stores and broadcasts msg, or forwards it to the node that
+// owns the room.
+func (s *Server) publish(ctx context.Context, room *chat.Room, msg *chat.Message) error {
+	if s.cluster != nil {
+		if owner, local := s.cluster.Owner(room.ID); !local {
+			stored, err := s.cluster.Forward(ctx, owner, msg)
+			if err != nil {
+				return err
+			}
+			*msg = *stored
+			return nil
+		}
+		room.ObserveSeq(s.takeOver(ctx, room.ID))
+	}
+
+	if err := room.Publish(ctx, msg, s.persist); err != nil {
+		return err
+	}
+	s.emitContext(ctx, webhook.EventMessage, room.ID, msg)
+	return nil
+}
+
+// since reads room history from the node that owns the room.
+func (s *Server) since(ctx context.Context, roomID string, seq uint64, limit int) ([]*chat.Message, error) {
+	if s.cluster != nil {
+		if owner, local := s.cluster.Owner(roomID); !local {
+			messages, err := s.cluster.History(ctx, owner, roomID, seq, limit)
+			if errors.Is(err, cluster.ErrNotFound) {
+				return nil, ErrRoomNotFound
+			}
+			return messages, err
+		}
+		s.takeOver(ctx, roomID)
+		messages, err := s.store.Since(ctx, roomID, seq, limit)
+		if err == nil && len(messages) == 0 {
+			// The room may never have been opened on this node, even though
+			// it owns it now.
+			if _, exists := s.lookupRoom(roomID); !exists && seq == 0 {
+				return nil, ErrRoomNotFound
+			}
+		}
+		return messages, err
+	}
+	return s.store.Since(ctx, roomID, seq, limit)
+}
+
+// handoff tracks, per room, the ring epoch at which this node last caught up
+// on the room's history, and the last sequence number it found.
+type handoff struct {
+	mu     sync.Mutex
+	epoch  uint64
+	latest uint64
+}
+
+// takeOver brings this node's history of a room it owns up to date and
+// returns the room's last sequence number. Ownership only moves when the ring
+// changes, so the other nodes are only asked once per epoch: the previous
+// owner, or the successor that kept a replica, has any messages this node
+// missed while it did not own the room.
+func (s *Server) takeOver(ctx context.Context, roomID string) uint64 {
+	value, _ := s.handoffs.LoadOrStore(roomID, &handoff{})
+	h := value.(*handoff)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	epoch := s.cluster.Epoch()
+	if h.epoch == epoch {
+		return h.latest
+	}
+
+	// Publishes to the room wait for the catch-up, so a peer that is down
+	// but not yet known to be is given little time.
+	ctx, cancel := context.WithTimeout(ctx, catchUpTimeout)
+	defer cancel()
+	latest := s.latestSeq(ctx, roomID)
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		missing []*chat.Message
+	)
+	for _, peer := range s.cluster.Peers() {
+		wg.Add(1)
+		go func(peer cluster.Peer) {
+			defer wg.Done()
+			messages, err := s.cluster.Replica(ctx, peer, roomID, latest)
+			if err != nil {
+				slog.Debug("Error fetching room history from peer", logging.Room(roomID), "peer", peer.ID, "error", err)
+				return
+			}
+			mu.Lock()
+			missing = append(missing, messages...)
+			mu.Unlock()
+		}(peer)
+	}
+	wg.Wait()
+
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Seq < missing[j].Seq })
+	for _, msg := range missing {
+		if msg.Seq <= latest {
+			continue
+		}
+		if err := s.store.Append(ctx, msg); err != nil {
+			slog.Error("Error storing handed-off message", logging.Room(roomID), "error", err)
+			break
+		}
+		latest = msg.Seq
+	}
+	if len(missing) > 0 {
+		slog.Info("Caught up on room history", logging.Room(roomID), "seq", latest)
+	}
+
+	h.epoch, h.latest = epoch, latest
+	return latest
+}
+
+func (s *Server) latestSeq(ctx context.Context, roomID string) uint64 {
+	messages, err := s.store.Since(ctx, roomID, 0, 0)
+	if err != nil || len(messages) == 0 {
+		return 0
+	}
+	return messages[len(messages)-1].Seq
+}
+
+// replicate queues a message this node just stored for the room's successor,
+// so the room's history survives this node leaving the ring. It runs while
+// the room's publishes are serialized, so it never waits on the network.
+func (s *Server) replicate(msg *chat.Message) {
+	if s.cluster == nil {
+		return
+	}
+	if peer, ok := s.cluster.Successor(msg.Room); ok {
+		s.replicas.enqueue(peer, msg)
+	}
+}
+
+// replicator sends replicated messages from one queue per peer. A peer that
+// stops answering only fills its own queue; once it is full, further
+// messages for it are dropped and logged.
+type replicator struct {
+	cluster *cluster.Cluster
+
+	mu     sync.Mutex
+	queues map[string]chan *chat.Message
+}
+
+func newReplicator(c *cluster.Cluster) *replicator {
+	return &replicator{cluster: c, queues: make(map[string]chan *chat.Message)}
+}
+
+func (r *replicator) enqueue(peer cluster.Peer, msg *chat.Message) {
+	r.mu.Lock()
+	queue, ok := r.queues[peer.ID]
+	if !ok {
+		queue = make(chan *chat.Message, replicationQueueSize)
+		r.queues[peer.ID] = queue
+		go r.run(peer, queue)
+	}
+	r.mu.Unlock()
+
+	select {
+	case queue <- msg:
+	default:
+		slog.Warn("Replication queue full; dropping message", logging.Room(msg.Room), "peer", peer.ID, "seq", msg.Seq)
+	}
+}
+
+// run sends what has piled up in queue, one request per room, in the order
+// the messages were stored.
+func (r *replicator) run(peer cluster.Peer, queue chan *chat.Message) {
+	for msg := range queue {
+		pending := []*chat.Message{msg}
+		for len(pending) < replicationBatchSize && len(queue) > 0 {
+			pending = append(pending, <-queue)
+		}
+
+		for len(pending) > 0 {
+			var batch, rest []*chat.Message
+			for _, msg := range pending {
+				if msg.Room == pending[0].Room {
+					batch = append(batch, msg)
+				} else {
+					rest = append(rest, msg)
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), replicationTimeout)
+			if err := r.cluster.Replicate(ctx, peer, batch); err != nil {
+				slog.Warn("Error replicating messages", logging.Room(batch[0].Room), "peer", peer.ID, "count", len(batch), "error", err)
+			}
+			cancel()
+			pending = rest
+		}
+	}
+}
+
+func (s *Server) clusterRoutes() {
+	if s.cluster == nil {
+		return
+	}
+	s.router.HandleFunc("/cluster/ping", s.handleClusterPing).Methods("GET")
+	s.router.HandleFunc("/cluster/rooms/{roomID}/messages", s.handleClusterMessage).Methods("POST")
+	s.router.HandleFunc("/cluster/rooms/{roomID}/history", s.handleClusterHistory).Methods("GET")
+	s.router.HandleFunc("/cluster/rooms/{roomID}/replica", s.handleClusterReplica).Methods("GET")
+	s.router.HandleFunc("/cluster/rooms/{roomID}/replica", s.handleStoreReplica).Methods("POST")
+}
+
+func (s *Server) handleClusterPing(w http.ResponseWriter, r *http.Request) {
+	if !s.cluster.Authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node":    s.cluster.Self().ID,
+		"members": s.cluster.Members(),
+	})
+}
+
+// handleClusterMessage publishes a message forwarded by another node. It is
+// accepted even if this node's view of the ring disagrees, so a message is
+// never bounced between nodes while membership settles.
+func (s *Server) handleClusterMessage(w http.ResponseWriter, r *http.Request) {
+	if !s.cluster.Authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.ReadOnly() {
+		http.Error(w, ErrReadOnly.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	roomID := mux.Vars(r)["roomID"]
+
+	var msg chat.Message
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, "Invalid message", http.StatusBadRequest)
+		return
+	}
+
+	ctx := tracing.ExtractHeader(r.Context(), r.Header)
+	room, err := s.getOrCreateRoom(roomID, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	room.ObserveSeq(s.takeOver(ctx, roomID))
+	if err := room.Publish(ctx, &msg, s.persist); err != nil {
+		slog.Error("Error publishing forwarded message", logging.Room(roomID), "error", err)
+		http.Error(w, "Message could not be stored", http.StatusInternalServerError)
+		return
+	}
+	s.emitContext(ctx, webhook.EventMessage, roomID, &msg)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&msg)
+}
+
+func (s *Server) handleClusterHistory(w http.ResponseWriter, r *http.Request) {
+	if !s.cluster.Authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	roomID := mux.Vars(r)["roomID"]
+
+	seq, _ := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	s.takeOver(r.Context(), roomID)
+	messages, err := s.store.Since(r.Context(), roomID, seq, limit)
+	if err != nil {
+		slog.Error("Error reading history", logging.Room(roomID), "error", err)
+		http.Error(w, "History unavailable", http.StatusInternalServerError)
+		return
+	}
+	if _, exists := s.lookupRoom(roomID); !exists && len(messages) == 0 && seq == 0 {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messages)
+}
+
+// handleClusterReplica serves the history this node holds for a room, as
+// owner or replica, without catching up first: it answers a peer that is
+// catching up itself.
+func (s *Server) handleClusterReplica(w http.ResponseWriter, r *http.Request) {
+	if !s.cluster.Authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	roomID := mux.Vars(r)["roomID"]
+
+	seq, _ := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+	messages, err := s.store.Since(r.Context(), roomID, seq, 0)
+	if err != nil {
+		slog.Error("Error reading history", logging.Room(roomID), "error", err)
+		http.Error(w, "History unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messages)
+}
+
+// handleStoreReplica keeps messages replicated by a room's owner. Messages
+// this node already holds, or that would land out of order, are skipped.
+func (s *Server) handleStoreReplica(w http.ResponseWriter, r *http.Request) {
+	if !s.cluster.Authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	roomID := mux.Vars(r)["roomID"]
+
+	var messages []*chat.Message
+	if err := json.NewDecoder(r.Body).Decode(&messages); err != nil {
+		http.Error(w, "Invalid messages", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	for _, msg := range messages {
+		if msg.Seq == 0 {
+			continue
+		}
+		msg.Room = roomID
+		newer, err := s.store.Since(ctx, roomID, msg.Seq-1, 1)
+		if err == nil && len(newer) == 0 {
+			err = s.store.Append(ctx, msg)
+		}
+		if err != nil {
+			slog.Error("Error storing replica", logging.Room(roomID), "error", err)
+			http.Error(w, "Replica could not be stored", http.StatusInternalServerError)
+			return
+		}
+		if room, exists := s.lookupRoom(roomID); exists {
+			room.ObserveSeq(msg.Seq)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"chat/internal/chat"
+	"chat/internal/command"
+	"chat/internal/webhook"
+)
+
+var (
+	errNameInUse   = errors.New("name is already in use")
+	errInvalidName = errors.New("names are 1 to 32 characters and may not contain spaces, control characters or / @ : , !")
+)
+
+const (
+	eventAction = "action"
+	eventNick   = "nick"
+	eventKicked = "kicked"
+)
+
+func (s *Server) registerBuiltinCommands() {
+	builtins := []command.Command{
+		{
+			Name:        "me",
+			Usage:       "<action>",
+			Description: "Describe what you are doing",
+			MinArgs:     1,
+			MaxArgs:     -1,
+			Writes:      true,
+			Handler:     s.commandMe,
+		},
+		{
+			Name:        "topic",
+			Usage:       "[topic]",
+			Description: "Show or change the room topic",
+			MaxArgs:     -1,
+			Handler:     s.commandTopic,
+		},
+		{
+			Name:        "nick",
+			Usage:       "<name>",
+			Description: "Change your display name",
+			MinArgs:     1,
+			MaxArgs:     1,
+			Handler:     s.commandNick,
+		},
+		{
+			Name:        "kick",
+			Usage:       "<name> [reason]",
+			Description: "Remove a member from the room (the room's owner only)",
+			MinArgs:     1,
+			MaxArgs:     -1,
+			Writes:      true,
+			Handler:     s.commandKick,
+		},
+		{
+			Name:        "who",
+			Description: "List the members of the room",
+			Handler:     s.commandWho,
+		},
+	}
+	for _, cmd := range builtins {
+		s.commands.Register(cmd)
+	}
+	s.commands.SetWriteGuard(s.writable)
+}
+
+func (s *Server) commandMe(ctx *command.Context) error {
+	msg := &chat.Message{Type: eventAction, Content: ctx.Text, Timestamp: time.Now()}
+	_, err := s.postMessage(context.Background(), ctx.Participant, ctx.Room, msg)
+	return err
+}
+
+func (s *Server) commandTopic(ctx *command.Context) error {
+	if ctx.Text == "" {
+		topic := ctx.Room.Info().Topic
+		if topic == "" {
+			ctx.Reply("No topic is set")
+		} else {
+			ctx.Reply("Topic: %s", topic)
+		}
+		return nil
+	}
+
+	_, err := s.updateRoom(ctx.Room, chat.RoomUpdate{Topic: &ctx.Text})
+	return err
+}
+
+func (s *Server) commandNick(ctx *command.Context) error {
+	return s.changeNick(ctx.Participant, ctx.Args[0])
+}
+
+// validateName checks a display name against the rules every way of naming a
+// member shares.
+func validateName(name string) error {
+	if name == "" || len(name) > 32 || strings.ContainsAny(name, " /@:,!") || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return errInvalidName
+	}
+	return nil
+}
+
+// changeNick renames participant and announces it in every room they are in.
+func (s *Server) changeNick(participant *chat.ChatParticipant, name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	old := participant.Name()
+	if !s.claimName(participant, name) {
+		return errNameInUse
+	}
+	for _, roomID := range participant.RoomIDs() {
+		if room, ok := participant.Room(roomID); ok {
+			room.Broadcast(chat.NewEvent(eventNick, roomID, map[string]string{"old": old, "new": name}))
+		}
+	}
+	return nil
+}
+
+func (s *Server) commandKick(ctx *command.Context) error {
+	if ctx.Room.Owner() == "" || ctx.Room.Owner() != ctx.Participant.Conn.ID() {
+		return errors.New("only the room's owner can kick members")
+	}
+
+	target := ctx.Args[0]
+	reason := strings.Join(ctx.Args[1:], " ")
+	if target == ctx.Participant.Name() {
+		return errors.New("you cannot kick yourself")
+	}
+	return s.kickMember(ctx.Room, target, reason, ctx.Participant.Name())
+}
+
+func (s *Server) kickMember(room *chat.Room, name, reason, by string) error {
+	kicked := 0
+	for _, member := range room.Members() {
+		if member.Name() != name {
+			continue
+		}
+		member.ExitRoom(room)
+		member.Conn.Send(chat.NewEvent(eventKicked, room.ID, map[string]string{"name": name, "reason": reason}))
+		s.emit(webhook.EventLeave, room.ID, member.Info())
+		kicked++
+	}
+	if kicked == 0 {
+		return errors.New("no such member")
+	}
+
+	room.Broadcast(chat.NewEvent(eventKicked, room.ID, map[string]string{"name": name, "reason": reason, "by": by}))
+	return nil
+}
+
+func (s *Server) commandWho(ctx *command.Context) error {
+	members := ctx.Room.Members()
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		if member.Bot {
+			names = append(names, member.Name()+" (bot)")
+		} else {
+			names = append(names, member.Name())
+		}
+	}
+	sort.Strings(names)
+
+	ctx.Reply("Members of %s: %s", ctx.Room.ID, strings.Join(names, ", "))
+	return nil
+}
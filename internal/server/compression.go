@@ -0,0 +1,39 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+
+	"chat/internal/chat"
+)
+
+// offersDeflate reports whether the client asked for permessage-deflate, in
+// which case the upgrader negotiates it when compression is enabled.
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// countingResponseWriter hands the upgrader a hijacked connection that counts
+// written bytes, so compressed frames can be measured on the wire.
+type countingResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	counted := chat.NewCountingConn(conn)
+	return counted, bufio.NewReadWriter(rw.Reader, bufio.NewWriter(counted)), nil
+}
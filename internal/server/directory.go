@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"chat/internal/chat"
+	"chat/internal/filter"
+)
+
+const eventDirect = "direct"
+
+func (s *Server) trackParticipant(participant *chat.ChatParticipant) {
+	s.participantsMu.Lock()
+	s.participants[participant] = true
+	s.participantsMu.Unlock()
+}
+
+func (s *Server) untrackParticipant(participant *chat.ChatParticipant) {
+	s.participantsMu.Lock()
+	delete(s.participants, participant)
+	s.participantsMu.Unlock()
+}
+
+// findParticipant looks up a connected participant by name. Names are unique
+// among connected participants, see changeNick.
+func (s *Server) findParticipant(name string) (*chat.ChatParticipant, bool) {
+	s.participantsMu.Lock()
+	defer s.participantsMu.Unlock()
+
+	for participant := range s.participants {
+		if participant.Name() == name {
+			return participant, true
+		}
+	}
+	return nil, false
+}
+
+// claimName renames participant unless another connected participant already
+// uses name. The check and the rename happen under one lock.
+func (s *Server) claimName(participant *chat.ChatParticipant, name string) bool {
+	s.participantsMu.Lock()
+	defer s.participantsMu.Unlock()
+
+	for other := range s.participants {
+		if other != participant && other.Name() == name {
+			return false
+		}
+	}
+	participant.SetName(name)
+	return true
+}
+
+// trackNamed tracks participant under name unless another connected
+// participant already uses it.
+func (s *Server) trackNamed(participant *chat.ChatParticipant, name string) bool {
+	s.participantsMu.Lock()
+	defer s.participantsMu.Unlock()
+
+	for other := range s.participants {
+		if other.Name() == name {
+			return false
+		}
+	}
+	participant.SetName(name)
+	s.participants[participant] = true
+	return true
+}
+
+// sendDirect delivers a private message to the participant called to and
+// echoes it back to the sender.
+func (s *Server) sendDirect(from *chat.ChatParticipant, to, content string) error {
+	if s.ReadOnly() {
+		return ErrReadOnly
+	}
+	target, ok := s.findParticipant(to)
+	if !ok {
+		return errors.New("no such user " + to)
+	}
+
+	msg := &chat.Message{
+		ID:        chat.NewMessageID(),
+		Type:      eventDirect,
+		Content:   content,
+		Sender:    from.Name(),
+		Timestamp: time.Now(),
+	}
+	verdict := s.filters.Run(msg)
+	if verdict.Action == filter.Reject {
+		return errors.New(verdict.Reason)
+	}
+
+	payload := chat.NewEvent(eventDirect, "", map[string]string{
+		"id":      msg.ID,
+		"sender":  msg.Sender,
+		"to":      to,
+		"content": msg.Content,
+	})
+	if verdict.Action != filter.Drop && target != from {
+		target.Conn.Send(payload)
+	}
+	from.Conn.Send(payload)
+	return nil
+}
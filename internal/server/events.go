@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat/internal/chat"
+	"chat/internal/logging"
+)
+
+const (
+	eventSession      = "session"
+	sseHeartbeat      = 15 * time.Second
+	replayLimit       = 500
+	headerLastEventID = "Last-Event-ID"
+)
+
+// handleEvents serves the Server-Sent Events transport. The stream opens with
+// a session event whose ID the client passes to /events/send and
+// /events/join.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.Draining() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	transport, err := chat.NewSSETransport(w)
+	if err != nil {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	participant := s.newParticipant(chat.NewTransportConnection(transport), r.RemoteAddr)
+	sess := s.addSession(participant, transport)
+	defer s.removeSession(sess.id)
+
+	lastEventID := r.Header.Get(headerLastEventID)
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	seqs := chat.ParseEventID(lastEventID)
+	transport.Resume(seqs)
+
+	transport.WriteMessage(chat.NewEvent(eventSession, "", map[string]string{
+		"session": sess.id,
+		"name":    participant.Name(),
+	}))
+
+	for _, roomID := range strings.Split(r.URL.Query().Get("rooms"), ",") {
+		if roomID = strings.TrimSpace(roomID); roomID == "" {
+			continue
+		}
+		if _, err := s.joinRoom(participant, roomID); err != nil {
+			transport.WriteMessage(chat.NewError(roomID, err.Error()))
+			continue
+		}
+		s.replay(r.Context(), transport, roomID, seqs[roomID])
+	}
+
+	go func() {
+		ticker := time.NewTicker(sseHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				transport.Close()
+				return
+			case <-transport.Done():
+				return
+			case <-ticker.C:
+				if err := transport.Heartbeat(); err != nil {
+					transport.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	participant.Logger().Info("SSE session opened")
+	s.handleParticipant(participant)
+}
+
+// replay writes the room history after seq straight to the transport, ahead
+// of any live traffic queued for the connection.
+func (s *Server) replay(ctx context.Context, transport chat.Transport, roomID string, seq uint64) {
+	if seq == 0 {
+		return
+	}
+	messages, err := s.since(ctx, roomID, seq, replayLimit)
+	if err != nil {
+		slog.Error("Error loading history", logging.Room(roomID), "error", err)
+		return
+	}
+	for _, msg := range messages {
+		payload, err := msg.Marshal()
+		if err != nil {
+			continue
+		}
+		if err := transport.WriteMessage(payload); err != nil {
+			return
+		}
+	}
+}
@@ -1,129 +1,435 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"chat/internal/chat"
+	"chat/internal/command"
+	"chat/internal/filter"
+	"chat/internal/logging"
+	"chat/internal/metrics"
+	"chat/internal/webhook"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	if s.Draining() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	batchMode := r.URL.Query().Get("batch")
+	if batchMode != "" && !chat.ValidBatchMode(batchMode) {
+		http.Error(w, "batch must be lines or envelope", http.StatusBadRequest)
+		return
+	}
+
+	var header http.Header
+	if codec, ok := chat.NegotiateCodec(websocket.Subprotocols(r)); ok {
+		header = http.Header{"Sec-Websocket-Protocol": {codec.Name()}}
+	}
+
+	opts := s.wsOptions
+	if s.config.Compression && offersDeflate(r) {
+		opts.Compress = true
+		w = countingResponseWriter{w}
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, header)
 	if err != nil {
-		log.Printf("Error upgrading to WebSocket: %v", err)
+		metrics.UpgradeFailures.Inc()
+		requestLogger(r).Warn("Error upgrading to WebSocket", "error", err)
 		http.Error(w, "Could not open websocket connection", http.StatusBadRequest)
 		return
 	}
 
-	connection := chat.NewConnection(conn)
-	participant := chat.NewChatParticipant(connection)
+	connection := chat.NewWebSocketConnection(conn, opts)
+	if batchMode != "" {
+		connection.EnableBatching(chat.BatchOptions{
+			Mode:        batchMode,
+			MaxMessages: s.config.BatchMaxMessages,
+			MaxDelay:    s.config.BatchMaxDelay,
+		})
+	}
 
+	participant := s.newParticipant(connection, r.RemoteAddr)
 	go s.handleParticipant(participant)
 }
 
+// newParticipant registers a guest for connection. Everything the
+// connection logs from then on carries its ID and the client's address.
+func (s *Server) newParticipant(connection *chat.Connection, remoteAddr string) *chat.ChatParticipant {
+	connection.SetRemoteAddr(remoteAddr)
+	connection.SetLogger(slog.Default().With(logging.KeyConn, connection.ID(), logging.KeyRemote, remoteAddr))
+	participant := chat.NewChatParticipant(connection)
+	s.trackParticipant(participant)
+	// A member may have taken the next guest name as a nickname already.
+	for !s.claimName(participant, fmt.Sprintf("guest-%d", atomic.AddUint64(&s.guests, 1))) {
+	}
+	return participant
+}
+
 func (s *Server) handleParticipant(participant *chat.ChatParticipant) {
-	participant.Conn.HandleMessage = func(message []byte) {
-		var msg map[string]interface{}
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
-			return
-		}
+	participant.Conn.HandleMessage = func(ctx context.Context, frame *chat.Inbound) {
+		logger := participant.Logger()
 
-		messageType, ok := msg["type"].(string)
-		if !ok {
-			log.Printf("Message type not found or not a string")
+		if frame.Type == "" {
+			logger.Warn("Message type not found or not a string")
 			return
 		}
+		countReceived(frame.Type)
 
-		switch messageType {
+		switch frame.Type {
 		case "chat":
-			roomName, ok := msg["room"].(string)
-			if !ok {
-				log.Printf("Room not found in chat message")
+			if frame.Room == "" {
+				logger.Warn("Room not found in chat message")
 				return
 			}
-			room, exists := participant.Rooms[roomName]
+			room, exists := participant.Room(frame.Room)
 			if !exists {
-				log.Printf("Participant not in room %s", roomName)
+				logger.Warn("Participant not in room", logging.Room(frame.Room))
 				return
 			}
-			log.Printf("received message for broadcast: %s", string(message))
-			room.Broadcast(message)
+			logger.Debug("Received chat message", logging.Room(frame.Room), logging.Content([]byte(frame.Content)))
+			s.handleChat(ctx, participant, room, frame)
 		case "join":
-			roomName, ok := msg["room"].(string)
-			if !ok {
-				log.Printf("Room not found in join message")
+			if frame.Room == "" {
+				logger.Warn("Room not found in join message")
 				return
 			}
-			s.mu.Lock()
-			room, exists := s.rooms[roomName]
-			if !exists {
-				room = chat.NewRoom(roomName)
-				s.rooms[roomName] = room
-				go room.Run()
+			if _, err := s.joinRoom(participant, frame.Room); err != nil {
+				participant.Conn.Send(chat.NewError(frame.Room, err.Error()))
+				return
 			}
-			s.mu.Unlock()
-			participant.JoinRoom(room)
-			log.Printf("Participant joined room: %s", roomName)
+			logger.Debug("Participant joined room", logging.Room(frame.Room))
 		case "leave":
-			roomName, ok := msg["room"].(string)
-			if !ok {
-				log.Printf("Room not found in leave message")
+			if frame.Room == "" {
+				logger.Warn("Room not found in leave message")
+				return
+			}
+			s.leaveRoom(participant, frame.Room)
+		case "nick":
+			if err := s.changeNick(participant, frame.Name); err != nil {
+				participant.Conn.Send(chat.NewError("", err.Error()))
+			}
+		case "direct":
+			if frame.To == "" || frame.Content == "" {
+				logger.Warn("Recipient or content missing in direct message")
+				return
+			}
+			if err := s.sendDirect(participant, frame.To, frame.Content); err != nil {
+				participant.Conn.Send(chat.NewError("", err.Error()))
+			}
+		case "set_topic":
+			if frame.Room == "" {
+				logger.Warn("Room not found in set_topic message")
+				return
+			}
+			if frame.Topic == nil {
+				logger.Warn("Topic not found in set_topic message", logging.Room(frame.Room))
+				return
+			}
+			room, exists := participant.Room(frame.Room)
+			if !exists {
+				logger.Warn("Participant not in room", logging.Room(frame.Room))
+				return
+			}
+			if _, err := s.updateRoom(room, chat.RoomUpdate{Topic: frame.Topic}); err != nil {
+				participant.Conn.Send(chat.NewError(frame.Room, err.Error()))
 				return
 			}
-			participant.LeaveRoom(roomName)
-			log.Printf("Participant left room: %s", roomName)
+			logger.Info("Room topic updated", logging.Room(frame.Room))
 		default:
-			log.Printf("Unknown message type: %s", messageType)
+			logger.Warn("Unknown message type", "type", frame.Type)
 		}
 	}
 
+	participant.Logger().Info("Connection opened")
 	go participant.Conn.WritePump()
 	onClose := func() {
-		for roomID, _ := range participant.Rooms {
-			participant.LeaveRoom(roomID)
-			log.Printf("Participant left room %s due to connection close", roomID)
+		for _, roomID := range participant.RoomIDs() {
+			s.leaveRoom(participant, roomID)
 		}
 	}
 
 	participant.Conn.ReadPump(onClose)
+	participant.Conn.Close()
+	<-participant.Conn.Stopped()
+	s.untrackParticipant(participant)
+	participant.Logger().Info("Connection closed")
+}
+
+type createRoomRequest struct {
+	Title       string            `json:"title"`
+	Topic       string            `json:"topic"`
+	Description string            `json:"description"`
+	Visibility  string            `json:"visibility"`
+	CreatedBy   string            `json:"created_by"`
+	Attributes  map[string]string `json:"attributes"`
+}
+
+func (s *Server) handleChat(ctx context.Context, participant *chat.ChatParticipant, room *chat.Room, frame *chat.Inbound) {
+	msg := &chat.Message{Content: frame.Content, Timestamp: frame.Timestamp}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
+	if command.IsCommand(msg.Content) {
+		s.commands.Dispatch(participant, room, msg.Content)
+		return
+	}
+	msg.Content = strings.TrimPrefix(msg.Content, command.Prefix)
+
+	if _, err := s.postMessage(ctx, participant, room, msg); err != nil {
+		participant.Conn.Send(chat.NewError(room.ID, err.Error()))
+	}
+}
+
+// postMessage runs msg through the filter chain and broadcasts it to the room
+// on behalf of participant. msg.Type defaults to chat. It returns the assigned message ID, or an error
+// carrying the reason when a filter rejected the message.
+func (s *Server) postMessage(ctx context.Context, participant *chat.ChatParticipant, room *chat.Room, msg *chat.Message) (string, error) {
+	msg.ID = chat.NewMessageID()
+	if msg.Type == "" {
+		msg.Type = "chat"
+	}
+	msg.Room = room.ID
+	msg.Sender = participant.Name()
+	msg.Bot = participant.Bot
+
+	if s.ReadOnly() {
+		return "", ErrReadOnly
+	}
+
+	_, span := tracer.Start(ctx, "chat.filter", trace.WithAttributes(chat.AttrRoom.String(room.ID)))
+	verdict := s.filters.Run(msg)
+	span.SetAttributes(attribute.Stringer("chat.filter.action", verdict.Action))
+	span.End()
+	if verdict.Action == filter.Reject {
+		participant.Logger().Info("Message rejected", logging.Room(room.ID), "reason", verdict.Reason)
+		return "", errors.New(verdict.Reason)
+	}
+
+	if verdict.Action == filter.Drop {
+		participant.Logger().Info("Message dropped", logging.Room(room.ID), "reason", verdict.Reason)
+		payload, err := msg.Marshal()
+		if err != nil {
+			return "", err
+		}
+		participant.Conn.Send(payload)
+		return msg.ID, nil
+	}
+
+	if err := s.publish(ctx, room, msg); err != nil {
+		participant.Logger().Error("Error publishing message", logging.Room(room.ID), "error", err)
+		return "", errors.New("message could not be stored")
+	}
+	return msg.ID, nil
+}
+
+// getOrCreateRoom opens the room if it does not exist yet. creator, if not
+// nil, becomes the room's owner. In maintenance mode only existing rooms are
+// returned.
+func (s *Server) getOrCreateRoom(roomID string, creator *chat.ChatParticipant) (*chat.Room, error) {
+	if s.ReadOnly() {
+		if room, exists := s.lookupRoom(roomID); exists {
+			return room, nil
+		}
+		return nil, ErrReadOnly
+	}
+	room, created := s.rooms.GetOrCreate(roomID, func() *chat.Room {
+		room := s.startRoom(chat.RoomInfo{ID: roomID})
+		if creator != nil {
+			room.SetOwner(creator.Conn.ID())
+		}
+		return room
+	})
+	if created {
+		s.emit(webhook.EventRoomCreated, roomID, room.Info())
+	}
+	return room, nil
+}
+
+func (s *Server) startRoom(info chat.RoomInfo) *chat.Room {
+	room := chat.NewRoomWithInfo(info)
+	if s.backplane != nil {
+		room.UseBackplane(s.backplane, s.node)
+	}
+	go room.Run()
+	return room
+}
+
+// joinRoom adds participant to the room, creating it if there is none. A room
+// that is being deleted turns new members away; the join then goes to the
+// room created in its place.
+func (s *Server) joinRoom(participant *chat.ChatParticipant, roomID string) (*chat.Room, error) {
+	for {
+		room, err := s.getOrCreateRoom(roomID, participant)
+		if err != nil {
+			return nil, err
+		}
+		if current, joined := participant.Room(roomID); joined && current == room {
+			return room, nil
+		}
+		if participant.JoinRoom(room) {
+			room.ClaimOwner(participant.Conn.ID())
+			room.Broadcast(chat.NewEvent(chat.EventJoin, room.ID, participant.Info()))
+			s.emit(webhook.EventJoin, room.ID, participant.Info())
+			return room, nil
+		}
+	}
+}
+
+func (s *Server) leaveRoom(participant *chat.ChatParticipant, roomID string) {
+	room, joined := participant.Room(roomID)
+	if !joined {
+		return
+	}
+	participant.LeaveRoom(roomID)
+	room.Broadcast(chat.NewEvent(chat.EventLeave, roomID, participant.Info()))
+	s.emit(webhook.EventLeave, roomID, participant.Info())
 }
 
 func (s *Server) handleRoomCreation(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	roomID := vars["roomID"]
 
-	log.Printf("Received request to create room: %s", roomID)
+	logger := requestLogger(r).With(logging.Room(roomID))
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if _, exists := s.rooms[roomID]; exists {
-		log.Printf("Room %s already exists", roomID)
-		http.Error(w, "Room already exists", http.StatusConflict)
+	var req createRoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		logger.Warn("Error decoding room creation request", "error", err)
+		http.Error(w, "Invalid room metadata", http.StatusBadRequest)
+		return
+	}
+	_, err := s.CreateRoom(chat.RoomInfo{
+		ID:          roomID,
+		Title:       req.Title,
+		Topic:       req.Topic,
+		Description: req.Description,
+		Visibility:  req.Visibility,
+		CreatedBy:   req.CreatedBy,
+		Attributes:  req.Attributes,
+	})
+	if err != nil {
+		logger.Warn("Error creating room", "error", err)
+		http.Error(w, err.Error(), apiErrorStatus(err))
 		return
 	}
 
-	room := chat.NewRoom(roomID)
-	s.rooms[roomID] = room
-	go room.Run()
-
-	log.Printf("Room %s created successfully", roomID)
+	logger.Info("Room created")
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte("Room created successfully"))
 }
 
 func (s *Server) handleListRooms(w http.ResponseWriter, r *http.Request) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	query, err := parseRoomListQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.IncludesPrivate() && !s.ValidAPIKey(bearerToken(r)) {
+		unauthorized(w)
+		return
+	}
+
+	page, err := s.ListRooms(query)
+	if err != nil {
+		http.Error(w, err.Error(), apiErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (s *Server) handleRoomUpdate(w http.ResponseWriter, r *http.Request) {
+	roomID := mux.Vars(r)["roomID"]
+
+	var update chat.RoomUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		requestLogger(r).Warn("Error decoding room update", logging.Room(roomID), "error", err)
+		http.Error(w, "Invalid room update", http.StatusBadRequest)
+		return
+	}
+
+	info, err := s.UpdateRoom(roomID, update)
+	if err != nil {
+		http.Error(w, err.Error(), apiErrorStatus(err))
+		return
+	}
+	requestLogger(r).Info("Room updated", logging.Room(roomID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func (s *Server) handleRoomDeletion(w http.ResponseWriter, r *http.Request) {
+	roomID := mux.Vars(r)["roomID"]
+
+	if err := s.DeleteRoom(roomID); err != nil {
+		http.Error(w, err.Error(), apiErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrRoomNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrRoomExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidArgument):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrReadOnly):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (s *Server) updateRoom(room *chat.Room, update chat.RoomUpdate) (chat.RoomInfo, error) {
+	if s.ReadOnly() {
+		return chat.RoomInfo{}, ErrReadOnly
+	}
+	info := room.Update(update)
+	room.Broadcast(chat.NewEvent(chat.EventRoomUpdated, room.ID, chat.RoomUpdated{RoomInfo: info, Update: update}))
+	s.emit(webhook.EventRoomUpdated, room.ID, info)
+	return info, nil
+}
+
+func (s *Server) handleListMembers(w http.ResponseWriter, r *http.Request) {
+	roomID := mux.Vars(r)["roomID"]
+
+	room, exists := s.lookupRoom(roomID)
+	if !exists {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
 
-	rooms := make([]string, 0, len(s.rooms))
-	for roomID := range s.rooms {
-		rooms = append(rooms, roomID)
+	members := room.Members()
+	infos := make([]chat.MemberInfo, 0, len(members))
+	for _, member := range members {
+		infos = append(infos, member.Info())
 	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(rooms)
+	json.NewEncoder(w).Encode(infos)
 }
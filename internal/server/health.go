@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+)
+
+// pinger is implemented by stores and backplanes that depend on a remote
+// service. Those that do not are always considered reachable.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	Connections    *int `json:"connections,omitempty"`
+	MaxConnections *int `json:"max_connections,omitempty"`
+}
+
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// Drain marks the server as shutting down: readiness fails and new
+// WebSocket upgrades are refused, while existing connections carry on.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": checkOK})
+}
+
+// handleReadyz reports whether the server should be sent new clients, with
+// the outcome of every check.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]checkResult{
+		"drain":       s.checkDrain(),
+		"store":       checkPing(ctx, s.store),
+		"backplane":   checkPing(ctx, s.backplane),
+		"connections": s.checkConnections(),
+	}
+
+	status := http.StatusOK
+	result := readiness{Status: checkOK, Checks: checks}
+	for _, check := range checks {
+		if check.Status != checkOK {
+			status = http.StatusServiceUnavailable
+			result.Status = checkFail
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *Server) checkDrain() checkResult {
+	if s.Draining() {
+		return checkResult{Status: checkFail, Error: "server is draining"}
+	}
+	return checkResult{Status: checkOK}
+}
+
+func checkPing(ctx context.Context, dependency interface{}) checkResult {
+	p, ok := dependency.(pinger)
+	if !ok {
+		return checkResult{Status: checkOK}
+	}
+	if err := p.Ping(ctx); err != nil {
+		return checkResult{Status: checkFail, Error: err.Error()}
+	}
+	return checkResult{Status: checkOK}
+}
+
+// checkConnections fails once the server holds MaxConnections clients, as
+// one more would exceed the ceiling. A ceiling of zero disables the check.
+func (s *Server) checkConnections() checkResult {
+	s.participantsMu.Lock()
+	connections := len(s.participants)
+	s.participantsMu.Unlock()
+
+	result := checkResult{Status: checkOK, Connections: &connections}
+	if max := s.config.MaxConnections; max > 0 {
+		result.MaxConnections = &max
+		if connections >= max {
+			result.Status = checkFail
+			result.Error = "connection ceiling reached"
+		}
+	}
+	return result
+}
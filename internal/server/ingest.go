@@ -0,0 +1,139 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"chat/internal/chat"
+	"chat/internal/logging"
+	"chat/internal/tracing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultIngestSender = "webhook"
+
+type ingestRequest struct {
+	Content string `json:"content"`
+	Sender  string `json:"sender"`
+}
+
+type ingestResponse struct {
+	ID string `json:"id"`
+}
+
+// handleRotateIngestToken issues a new secret token for posting into the room
+// over HTTP. Only a hash is kept, so the token is shown exactly once. It is
+// served behind requireAPIKey, since a new token revokes the old one.
+func (s *Server) handleRotateIngestToken(w http.ResponseWriter, r *http.Request) {
+	roomID := mux.Vars(r)["roomID"]
+	if _, ok := s.lookupRoom(roomID); !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	b := make([]byte, 24)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	s.ingestTokens[roomID] = sha256.Sum256([]byte(token))
+	s.mu.Unlock()
+	requestLogger(r).Info("Ingest token rotated", logging.Room(roomID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+func (s *Server) handleIngestMessage(w http.ResponseWriter, r *http.Request) {
+	roomID := mux.Vars(r)["roomID"]
+	room, ok := s.lookupRoom(roomID)
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	if !s.authorizeIngest(roomID, bearerToken(r)) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chat"`)
+		http.Error(w, "Invalid or missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var req ingestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Content) == "" {
+		http.Error(w, "Message content is required", http.StatusBadRequest)
+		return
+	}
+	if req.Sender == "" {
+		req.Sender = defaultIngestSender
+	}
+	if err := validateName(req.Sender); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The poster is not a member, so claiming the name only checks that no
+	// connected member goes by it.
+	participant := chat.NewChatParticipant(chat.NewLocalConnection())
+	participant.Bot = true
+	if !s.claimName(participant, req.Sender) {
+		http.Error(w, errNameInUse.Error(), http.StatusConflict)
+		return
+	}
+
+	ctx, span := tracer.Start(r.Context(), "chat.ingest", append(tracing.Link(tracing.ExtractHeader(r.Context(), r.Header)),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(chat.AttrRoom.String(roomID)))...)
+	id, err := s.postMessage(ctx, participant, room, &chat.Message{Content: req.Content, Timestamp: time.Now()})
+	chat.EndSpan(span, err)
+	if errors.Is(err, ErrReadOnly) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	requestLogger(r).Debug("Message posted over HTTP", logging.Room(roomID), "message_id", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ingestResponse{ID: id})
+}
+
+// authorizeIngest accepts either the room's ingest token or one of the
+// configured API keys.
+func (s *Server) authorizeIngest(roomID, token string) bool {
+	if token == "" {
+		return false
+	}
+	if matchKey(s.config.APIKeys, token) {
+		return true
+	}
+
+	s.mu.RLock()
+	expected, ok := s.ingestTokens[roomID]
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare(expected[:], sum[:]) == 1
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
@@ -0,0 +1,547 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"chat/internal/chat"
+	"chat/internal/command"
+)
+
+const ircServerName = "chat.gateway"
+
+// ServeIRC accepts IRC clients until the listener is closed. Channels map to
+// rooms (#lobby is room lobby), nicknames to participant names and PRIVMSG to
+// chat or direct messages.
+func (s *Server) ServeIRC(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveIRCClient(conn)
+	}
+}
+
+func (s *Server) serveIRCClient(conn net.Conn) {
+	client := &ircClient{lineTransport: newLineTransport(conn), server: s}
+	if s.Draining() {
+		client.writeLine("ERROR :" + ErrDraining.Error())
+		client.Close()
+		return
+	}
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		client.host = host
+	}
+	client.participant = s.newParticipant(chat.NewTransportConnection(client), conn.RemoteAddr().String())
+
+	client.participant.Logger().Info("IRC client connected")
+	s.handleParticipant(client.participant)
+}
+
+type ircMessage struct {
+	command string
+	params  []string
+}
+
+func parseIRC(line string) ircMessage {
+	if strings.HasPrefix(line, ":") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+
+	var trailing string
+	hasTrailing := false
+	if strings.HasPrefix(line, ":") {
+		trailing, line, hasTrailing = line[1:], "", true
+	} else if i := strings.Index(line, " :"); i >= 0 {
+		trailing, line, hasTrailing = line[i+2:], line[:i], true
+	}
+
+	fields := strings.Fields(line)
+	msg := ircMessage{}
+	if len(fields) > 0 {
+		msg.command = strings.ToUpper(fields[0])
+		msg.params = fields[1:]
+	}
+	if hasTrailing {
+		msg.params = append(msg.params, trailing)
+	}
+	return msg
+}
+
+// ircClient is the transport of an IRC connection. Commands that map onto
+// client frames (JOIN, PART, PRIVMSG, TOPIC changes) are handed to the regular
+// frame handler; queries such as NAMES, WHO and PING are answered directly.
+type ircClient struct {
+	*lineTransport
+	server      *Server
+	participant *chat.ChatParticipant
+	host        string
+
+	nickGiven  bool
+	registered bool
+	queued     [][]byte
+
+	// user and lastNick are shared between the read and write pumps.
+	mu       sync.Mutex
+	user     string
+	lastNick string
+}
+
+func (c *ircClient) ReadMessage() ([]byte, error) {
+	for {
+		if len(c.queued) > 0 {
+			frame := c.queued[0]
+			c.queued = c.queued[1:]
+			return frame, nil
+		}
+
+		if !c.scanner.Scan() {
+			if err := c.scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		line := strings.TrimSpace(c.scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := c.handle(parseIRC(line)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *ircClient) queue(frame map[string]string) {
+	payload, _ := json.Marshal(frame)
+	c.queued = append(c.queued, payload)
+}
+
+func (c *ircClient) handle(msg ircMessage) error {
+	switch msg.command {
+	case "CAP":
+		if len(msg.params) > 0 && strings.ToUpper(msg.params[0]) == "LS" {
+			c.writeLine(":" + ircServerName + " CAP * LS :")
+		}
+		return nil
+	case "PASS", "PONG":
+		return nil
+	case "PING":
+		token := ircServerName
+		if len(msg.params) > 0 {
+			token = msg.params[0]
+		}
+		c.writeLine(fmt.Sprintf(":%s PONG %s :%s", ircServerName, ircServerName, token))
+		return nil
+	case "NICK":
+		c.handleNick(msg)
+		return nil
+	case "USER":
+		if len(msg.params) < 4 {
+			c.numeric("461", "USER", "Not enough parameters")
+			return nil
+		}
+		if c.registered {
+			c.numeric("462", "You may not reregister")
+			return nil
+		}
+		c.mu.Lock()
+		c.user = msg.params[0]
+		c.mu.Unlock()
+		c.tryRegister()
+		return nil
+	case "QUIT":
+		c.writeLine("ERROR :Closing link")
+		return io.EOF
+	}
+
+	if !c.registered {
+		c.numeric("451", "You have not registered")
+		return nil
+	}
+
+	switch msg.command {
+	case "JOIN":
+		c.handleJoin(msg)
+	case "PART":
+		if len(msg.params) == 0 {
+			c.numeric("461", "PART", "Not enough parameters")
+			return nil
+		}
+		for _, channel := range strings.Split(msg.params[0], ",") {
+			c.queue(map[string]string{"type": "leave", "room": ircRoom(channel)})
+		}
+	case "PRIVMSG", "NOTICE":
+		c.handlePrivmsg(msg)
+	case "TOPIC":
+		c.handleTopic(msg)
+	case "NAMES":
+		if len(msg.params) == 0 {
+			c.numeric("366", "*", "End of /NAMES list")
+			return nil
+		}
+		for _, channel := range strings.Split(msg.params[0], ",") {
+			c.sendNames(ircRoom(channel))
+		}
+	case "WHO":
+		c.handleWho(msg)
+	case "WHOIS":
+		c.handleWhois(msg)
+	case "LIST":
+		c.handleList()
+	case "MODE":
+		if len(msg.params) > 0 && isChannel(msg.params[0]) {
+			c.numeric("324", msg.params[0], "+")
+		} else {
+			c.numeric("221", "+")
+		}
+	default:
+		c.numeric("421", msg.command, "Unknown command")
+	}
+	return nil
+}
+
+func (c *ircClient) handleNick(msg ircMessage) {
+	if len(msg.params) == 0 {
+		c.numeric("431", "No nickname given")
+		return
+	}
+
+	nick := msg.params[0]
+	old := c.participant.Name()
+	if err := c.server.changeNick(c.participant, nick); err != nil {
+		if errors.Is(err, errNameInUse) {
+			c.numeric("433", nick, "Nickname is already in use")
+		} else {
+			c.numeric("432", nick, "Erroneous nickname")
+		}
+		return
+	}
+
+	if !c.registered {
+		c.nickGiven = true
+		c.tryRegister()
+		return
+	}
+	if c.markNick(old, nick) {
+		c.writeLine(fmt.Sprintf(":%s NICK :%s", c.prefixFor(old), nick))
+	}
+}
+
+func (c *ircClient) tryRegister() {
+	c.mu.Lock()
+	user := c.user
+	c.mu.Unlock()
+	if c.registered || !c.nickGiven || user == "" {
+		return
+	}
+	c.registered = true
+
+	nick := c.participant.Name()
+	c.numeric("001", fmt.Sprintf("Welcome to the chat IRC gateway %s", c.prefixFor(nick)))
+	c.numeric("002", "Your host is "+ircServerName)
+	c.numeric("003", "This server bridges IRC channels to chat rooms")
+	c.numeric("004", ircServerName, "chat", "o", "nt")
+	c.numeric("422", "MOTD File is missing")
+}
+
+func (c *ircClient) handleJoin(msg ircMessage) {
+	if len(msg.params) == 0 {
+		c.numeric("461", "JOIN", "Not enough parameters")
+		return
+	}
+	if msg.params[0] == "0" {
+		for _, roomID := range c.participant.RoomIDs() {
+			c.queue(map[string]string{"type": "leave", "room": roomID})
+		}
+		return
+	}
+	for _, channel := range strings.Split(msg.params[0], ",") {
+		if !isChannel(channel) || len(channel) < 2 {
+			c.numeric("403", channel, "No such channel")
+			continue
+		}
+		c.queue(map[string]string{"type": "join", "room": ircRoom(channel)})
+	}
+}
+
+func (c *ircClient) handlePrivmsg(msg ircMessage) {
+	if len(msg.params) < 2 {
+		if msg.command == "PRIVMSG" {
+			c.numeric("412", "No text to send")
+		}
+		return
+	}
+
+	target, text := msg.params[0], msg.params[1]
+	if action, ok := strings.CutPrefix(text, "\x01ACTION "); ok {
+		text = command.Prefix + "me " + strings.TrimSuffix(action, "\x01")
+	} else if strings.HasPrefix(text, command.Prefix) {
+		text = command.Prefix + text
+	}
+
+	if isChannel(target) {
+		room := ircRoom(target)
+		if _, joined := c.participant.Room(room); !joined {
+			c.numeric("404", target, "Cannot send to channel")
+			return
+		}
+		c.queue(map[string]string{"type": "chat", "room": room, "content": text})
+		return
+	}
+
+	if _, ok := c.server.findParticipant(target); !ok {
+		c.numeric("401", target, "No such nick/channel")
+		return
+	}
+	c.queue(map[string]string{"type": "direct", "to": target, "content": strings.TrimPrefix(text, command.Prefix+command.Prefix)})
+}
+
+func (c *ircClient) handleTopic(msg ircMessage) {
+	if len(msg.params) == 0 {
+		c.numeric("461", "TOPIC", "Not enough parameters")
+		return
+	}
+
+	channel := msg.params[0]
+	room := ircRoom(channel)
+	if len(msg.params) > 1 {
+		if _, joined := c.participant.Room(room); !joined {
+			c.numeric("442", channel, "You're not on that channel")
+			return
+		}
+		c.queue(map[string]string{"type": "set_topic", "room": room, "topic": msg.params[1]})
+		return
+	}
+	c.sendTopic(room)
+}
+
+func (c *ircClient) sendTopic(roomID string) {
+	room, ok := c.server.lookupRoom(roomID)
+	if !ok {
+		c.numeric("403", "#"+roomID, "No such channel")
+		return
+	}
+	if topic := room.Info().Topic; topic != "" {
+		c.numeric("332", "#"+roomID, topic)
+	} else {
+		c.numeric("331", "#"+roomID, "No topic is set")
+	}
+}
+
+func (c *ircClient) sendNames(roomID string) {
+	if room, ok := c.server.lookupRoom(roomID); ok {
+		names := memberNames(room)
+		for len(names) > 0 {
+			n := len(names)
+			if n > 20 {
+				n = 20
+			}
+			c.numeric("353", "=", "#"+roomID, strings.Join(names[:n], " "))
+			names = names[n:]
+		}
+	}
+	c.numeric("366", "#"+roomID, "End of /NAMES list")
+}
+
+func (c *ircClient) handleWho(msg ircMessage) {
+	mask := "*"
+	if len(msg.params) > 0 {
+		mask = msg.params[0]
+	}
+	if isChannel(mask) {
+		if room, ok := c.server.lookupRoom(ircRoom(mask)); ok {
+			for _, name := range memberNames(room) {
+				c.numeric("352", mask, name, "chat", ircServerName, name, "H", "0 "+name)
+			}
+		}
+	} else if _, ok := c.server.findParticipant(mask); ok {
+		c.numeric("352", "*", mask, "chat", ircServerName, mask, "H", "0 "+mask)
+	}
+	c.numeric("315", mask, "End of /WHO list")
+}
+
+func (c *ircClient) handleWhois(msg ircMessage) {
+	if len(msg.params) == 0 {
+		c.numeric("431", "No nickname given")
+		return
+	}
+	nick := msg.params[len(msg.params)-1]
+	target, ok := c.server.findParticipant(nick)
+	if !ok {
+		c.numeric("401", nick, "No such nick/channel")
+		c.numeric("318", nick, "End of /WHOIS list")
+		return
+	}
+
+	c.numeric("311", nick, nick, "chat", "*", nick)
+	if rooms := target.RoomIDs(); len(rooms) > 0 {
+		sort.Strings(rooms)
+		for i := range rooms {
+			rooms[i] = "#" + rooms[i]
+		}
+		c.numeric("319", nick, strings.Join(rooms, " "))
+	}
+	c.numeric("318", nick, "End of /WHOIS list")
+}
+
+func (c *ircClient) handleList() {
+	rooms := make([]chat.RoomSummary, 0, c.server.rooms.Len())
+	c.server.rooms.Range(func(room *chat.Room) bool {
+		rooms = append(rooms, room.Summary())
+		return true
+	})
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+
+	c.numeric("321", "Channel", "Users  Name")
+	for _, room := range rooms {
+		if room.Visibility == chat.VisibilityPublic {
+			c.numeric("322", "#"+room.ID, fmt.Sprint(room.Members), room.Topic)
+		}
+	}
+	c.numeric("323", "End of /LIST")
+}
+
+// WriteMessage renders a server frame as IRC lines.
+func (c *ircClient) WriteMessage(message []byte) error {
+	var frame struct {
+		Type    string                 `json:"type"`
+		Room    string                 `json:"room"`
+		Sender  string                 `json:"sender"`
+		Content string                 `json:"content"`
+		Data    map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(message, &frame); err != nil {
+		return nil
+	}
+	data := func(key string) string {
+		value, _ := frame.Data[key].(string)
+		return value
+	}
+
+	nick := c.participant.Name()
+	channel := "#" + frame.Room
+
+	switch frame.Type {
+	case "chat":
+		if frame.Sender == nick {
+			return nil
+		}
+		return c.writeLine(fmt.Sprintf(":%s PRIVMSG %s :%s", c.prefixFor(frame.Sender), channel, frame.Content))
+	case eventAction:
+		if frame.Sender == nick {
+			return nil
+		}
+		return c.writeLine(fmt.Sprintf(":%s PRIVMSG %s :\x01ACTION %s\x01", c.prefixFor(frame.Sender), channel, frame.Content))
+	case eventDirect:
+		if data("sender") == nick {
+			return nil
+		}
+		return c.writeLine(fmt.Sprintf(":%s PRIVMSG %s :%s", c.prefixFor(data("sender")), nick, data("content")))
+	case chat.EventJoin:
+		if err := c.writeLine(fmt.Sprintf(":%s JOIN %s", c.prefixFor(data("name")), channel)); err != nil {
+			return err
+		}
+		if data("name") == nick {
+			c.sendTopic(frame.Room)
+			c.sendNames(frame.Room)
+		}
+		return nil
+	case chat.EventLeave:
+		return c.writeLine(fmt.Sprintf(":%s PART %s", c.prefixFor(data("name")), channel))
+	case eventNick:
+		if !c.markNick(data("old"), data("new")) {
+			return nil
+		}
+		return c.writeLine(fmt.Sprintf(":%s NICK :%s", c.prefixFor(data("old")), data("new")))
+	case eventKicked:
+		by := data("by")
+		if by == "" {
+			by = ircServerName
+		}
+		return c.writeLine(fmt.Sprintf(":%s KICK %s %s :%s", c.prefixFor(by), channel, data("name"), data("reason")))
+	case chat.EventRoomUpdated:
+		if !topicChanged(frame.Data) {
+			return nil
+		}
+		return c.writeLine(fmt.Sprintf(":%s TOPIC %s :%s", ircServerName, channel, data("topic")))
+	case command.EventSystem, chat.EventError:
+		text := data("content")
+		if frame.Type == chat.EventError {
+			text = data("reason")
+		}
+		for _, line := range strings.Split(text, "\n") {
+			if err := c.writeLine(fmt.Sprintf(":%s NOTICE %s :%s", ircServerName, nick, line)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// numeric sends a numeric reply. The last parameter is always sent as the
+// trailing parameter.
+func (c *ircClient) numeric(code string, params ...string) {
+	line := fmt.Sprintf(":%s %s %s", ircServerName, code, c.participant.Name())
+	for i, param := range params {
+		if i == len(params)-1 {
+			line += " :" + param
+		} else {
+			line += " " + param
+		}
+	}
+	c.writeLine(line)
+}
+
+// markNick records a nick change and reports whether it is new. The change
+// is announced once per room the client shares with the renamed user, but
+// IRC clients expect a single NICK line.
+func (c *ircClient) markNick(old, nick string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := old + " " + nick
+	if key == c.lastNick {
+		return false
+	}
+	c.lastNick = key
+	return true
+}
+
+func (c *ircClient) prefixFor(nick string) string {
+	c.mu.Lock()
+	user := c.user
+	c.mu.Unlock()
+
+	if nick == c.participant.Name() && user != "" {
+		return fmt.Sprintf("%s!%s@%s", nick, user, c.host)
+	}
+	return fmt.Sprintf("%s!%s@chat", nick, nick)
+}
+
+func memberNames(room *chat.Room) []string {
+	members := room.Members()
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		names = append(names, member.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isChannel(name string) bool {
+	return strings.HasPrefix(name, "#") || strings.HasPrefix(name, "&")
+}
+
+func ircRoom(channel string) string {
+	return strings.TrimLeft(channel, "#&")
+}
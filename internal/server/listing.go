@@ -0,0 +1,241 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat/internal/chat"
+)
+
+const (
+	sortByName     = "name"
+	sortByActivity = "activity"
+	sortBySize     = "size"
+
+	// visibilityAll lists public and private rooms alike.
+	visibilityAll = "all"
+
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// RoomQuery selects and orders a page of rooms. Zero values fall back to the
+// defaults of GET /rooms: public rooms, sorted by title, 50 per page. Private
+// rooms are only listed when asked for, with visibility "private" or "all",
+// and GET /rooms then requires an API key.
+type RoomQuery struct {
+	Search     string `json:"q,omitempty"`
+	Sort       string `json:"sort,omitempty"`
+	Visibility string `json:"visibility,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	Cursor     string `json:"cursor,omitempty"`
+}
+
+// RoomPage is one page of a room listing. NextCursor is empty on the last page.
+type RoomPage struct {
+	Rooms      []chat.RoomSummary `json:"rooms"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// IncludesPrivate reports whether the query lists private rooms.
+func (q RoomQuery) IncludesPrivate() bool {
+	return q.Visibility == chat.VisibilityPrivate || q.Visibility == visibilityAll
+}
+
+type roomListQuery struct {
+	search     string
+	sort       string
+	visibility string
+	limit      int
+	after      *listCursor
+}
+
+// listCursor identifies the last room of a page. It is handed to clients as an
+// opaque token so the next page can resume strictly after it, whatever the
+// sort order.
+type listCursor struct {
+	Sort         string    `json:"s"`
+	ID           string    `json:"id"`
+	Title        string    `json:"t,omitempty"`
+	Members      int       `json:"m,omitempty"`
+	LastActivity time.Time `json:"a,omitempty"`
+}
+
+func parseRoomListQuery(values url.Values) (RoomQuery, error) {
+	q := RoomQuery{
+		Search:     values.Get("q"),
+		Sort:       values.Get("sort"),
+		Visibility: values.Get("visibility"),
+		Cursor:     values.Get("cursor"),
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return q, invalidArgument("limit must be a positive integer")
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+func (q RoomQuery) compile() (roomListQuery, error) {
+	c := roomListQuery{
+		search:     strings.ToLower(strings.TrimSpace(q.Search)),
+		sort:       q.Sort,
+		visibility: q.Visibility,
+		limit:      q.Limit,
+	}
+
+	switch c.sort {
+	case "":
+		c.sort = sortByName
+	case sortByName, sortByActivity, sortBySize:
+	default:
+		return c, invalidArgument("sort must be one of name, activity or size")
+	}
+
+	switch {
+	case c.visibility == "":
+		c.visibility = chat.VisibilityPublic
+	case c.visibility == visibilityAll:
+		c.visibility = ""
+	case !validVisibility(c.visibility):
+		return c, invalidArgument("visibility must be public, private or all")
+	}
+
+	switch {
+	case c.limit < 0:
+		return c, invalidArgument("limit must be a positive integer")
+	case c.limit == 0:
+		c.limit = defaultPageSize
+	case c.limit > maxPageSize:
+		c.limit = maxPageSize
+	}
+
+	if q.Cursor != "" {
+		after, err := decodeCursor(q.Cursor)
+		if err != nil || after.Sort != c.sort {
+			return c, invalidArgument("invalid cursor")
+		}
+		c.after = after
+	}
+
+	return c, nil
+}
+
+func listRooms(rooms []chat.RoomSummary, q roomListQuery) RoomPage {
+	matched := rooms[:0]
+	for _, room := range rooms {
+		if q.visibility != "" && room.Visibility != q.visibility {
+			continue
+		}
+		if q.search != "" && !matchesSearch(room, q.search) {
+			continue
+		}
+		matched = append(matched, room)
+	}
+
+	less := roomOrder(q.sort)
+	sort.Slice(matched, func(i, j int) bool {
+		return less(matched[i], matched[j])
+	})
+
+	start := 0
+	if q.after != nil {
+		after := chat.RoomSummary{
+			RoomInfo:     chat.RoomInfo{ID: q.after.ID, Title: q.after.Title},
+			Members:      q.after.Members,
+			LastActivity: q.after.LastActivity,
+		}
+		start = sort.Search(len(matched), func(i int) bool {
+			return less(after, matched[i])
+		})
+	}
+
+	end := start + q.limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	resp := RoomPage{Rooms: matched[start:end]}
+	if end < len(matched) {
+		last := matched[end-1]
+		resp.NextCursor = encodeCursor(listCursor{
+			Sort:         q.sort,
+			ID:           last.ID,
+			Title:        last.Title,
+			Members:      last.Members,
+			LastActivity: last.LastActivity,
+		})
+	}
+	return resp
+}
+
+func matchesSearch(room chat.RoomSummary, search string) bool {
+	return strings.Contains(strings.ToLower(room.ID), search) ||
+		strings.Contains(strings.ToLower(room.Title), search) ||
+		strings.Contains(strings.ToLower(room.Topic), search)
+}
+
+// roomOrder returns a strict total order for the given sort key. Ties are
+// broken by room ID so that cursors stay stable between pages.
+func roomOrder(sortBy string) func(a, b chat.RoomSummary) bool {
+	switch sortBy {
+	case sortByActivity:
+		return func(a, b chat.RoomSummary) bool {
+			if !a.LastActivity.Equal(b.LastActivity) {
+				return a.LastActivity.After(b.LastActivity)
+			}
+			return a.ID < b.ID
+		}
+	case sortBySize:
+		return func(a, b chat.RoomSummary) bool {
+			if a.Members != b.Members {
+				return a.Members > b.Members
+			}
+			return a.ID < b.ID
+		}
+	default:
+		return func(a, b chat.RoomSummary) bool {
+			if x, y := sortName(a), sortName(b); x != y {
+				return x < y
+			}
+			return a.ID < b.ID
+		}
+	}
+}
+
+// sortName is the room's title, or its ID for rooms without one, folded to
+// lower case.
+func sortName(room chat.RoomSummary) string {
+	if room.Title != "" {
+		return strings.ToLower(room.Title)
+	}
+	return strings.ToLower(room.ID)
+}
+
+func encodeCursor(c listCursor) string {
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodeCursor(token string) (*listCursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var c listCursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func validVisibility(visibility string) bool {
+	return visibility == chat.VisibilityPublic || visibility == chat.VisibilityPrivate
+}
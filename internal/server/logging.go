@@ -0,0 +1,14 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"chat/internal/logging"
+)
+
+// requestLogger returns the logger for an HTTP request that is not tied to a
+// connection.
+func requestLogger(r *http.Request) *slog.Logger {
+	return slog.Default().With(logging.KeyRemote, r.RemoteAddr)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+
+	"chat/internal/chat"
+	"chat/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// inboundTypes are the frame types counted by name in
+// chat_messages_received_total; anything else a client sends is counted as
+// "unknown" so clients cannot create label values.
+var inboundTypes = map[string]bool{
+	"chat":      true,
+	"join":      true,
+	"leave":     true,
+	"nick":      true,
+	"direct":    true,
+	"set_topic": true,
+}
+
+func countReceived(messageType string) {
+	if !inboundTypes[messageType] {
+		messageType = "unknown"
+	}
+	metrics.MessagesReceived.WithLabelValues(messageType).Inc()
+}
+
+var (
+	connectionsDesc = prometheus.NewDesc("chat_connections_active",
+		"Connected participants, over every transport.", nil, nil)
+	roomsDesc = prometheus.NewDesc("chat_rooms",
+		"Rooms hosted by this server.", nil, nil)
+	membersDesc = prometheus.NewDesc("chat_room_members",
+		"Distribution of local members per room.", nil, nil)
+
+	compressedDesc = prometheus.NewDesc("chat_ws_compressed_messages_total",
+		"WebSocket messages written with permessage-deflate.", nil, nil)
+	uncompressedDesc = prometheus.NewDesc("chat_ws_uncompressed_messages_total",
+		"WebSocket messages below the compression threshold on compressing connections.", nil, nil)
+	compressedPayloadDesc = prometheus.NewDesc("chat_ws_compressed_payload_bytes_total",
+		"Size of compressed WebSocket messages before compression.", nil, nil)
+	compressedWireDesc = prometheus.NewDesc("chat_ws_compressed_wire_bytes_total",
+		"Bytes written on the network for compressed WebSocket messages.", nil, nil)
+)
+
+// serverCollector reports the gauges that belong to a single Server. They
+// are computed at scrape time rather than tracked on every change.
+type serverCollector struct {
+	s *Server
+}
+
+func (c serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- connectionsDesc
+	ch <- roomsDesc
+	ch <- membersDesc
+	ch <- compressedDesc
+	ch <- uncompressedDesc
+	ch <- compressedPayloadDesc
+	ch <- compressedWireDesc
+}
+
+func (c serverCollector) Collect(ch chan<- prometheus.Metric) {
+	c.s.participantsMu.Lock()
+	connections := len(c.s.participants)
+	c.s.participantsMu.Unlock()
+	ch <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(connections))
+
+	var rooms uint64
+	var members float64
+	buckets := make(map[float64]uint64, len(metrics.MemberBuckets))
+	c.s.rooms.Range(func(room *chat.Room) bool {
+		n := float64(room.MemberCount())
+		rooms++
+		members += n
+		for _, bound := range metrics.MemberBuckets {
+			if n <= bound {
+				buckets[bound]++
+			}
+		}
+		return true
+	})
+	ch <- prometheus.MustNewConstMetric(roomsDesc, prometheus.GaugeValue, float64(rooms))
+	ch <- prometheus.MustNewConstHistogram(membersDesc, rooms, members, buckets)
+
+	compression := chat.Compression.Snapshot()
+	ch <- prometheus.MustNewConstMetric(compressedDesc, prometheus.CounterValue, float64(compression.Messages))
+	ch <- prometheus.MustNewConstMetric(uncompressedDesc, prometheus.CounterValue, float64(compression.Skipped))
+	ch <- prometheus.MustNewConstMetric(compressedPayloadDesc, prometheus.CounterValue, float64(compression.PayloadBytes))
+	ch <- prometheus.MustNewConstMetric(compressedWireDesc, prometheus.CounterValue, float64(compression.WireBytes))
+}
+
+// MetricsHandler serves the process-wide collectors together with this
+// server's gauges in the Prometheus text format.
+func (s *Server) MetricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(serverCollector{s})
+	gatherers := prometheus.Gatherers{metrics.Registry, registry}
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+}
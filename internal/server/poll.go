@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat/internal/chat"
+)
+
+const (
+	defaultPollWait     = 25 * time.Second
+	maxPollWait         = 60 * time.Second
+	defaultPollTTL      = time.Minute
+	maxPollQueue        = 1024
+	pollReaperFrequency = 5 * time.Second
+)
+
+type pollResponse struct {
+	Session string            `json:"session"`
+	Frames  []json.RawMessage `json:"frames"`
+}
+
+// handlePoll serves the long-polling transport. A request without a session
+// opens one (joining the rooms listed in rooms=) and returns its ID; later
+// requests return every frame queued since the previous poll, waiting up to
+// wait= seconds for the first one.
+func (s *Server) handlePoll(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	sessionID := query.Get("session")
+	if sessionID == "" {
+		// Sessions opened before the drain keep polling; new ones are refused.
+		if s.Draining() {
+			http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		sess := s.openPollSession(strings.Split(query.Get("rooms"), ","), r.RemoteAddr)
+		writePollResponse(w, pollResponse{Session: sess.id, Frames: []json.RawMessage{}})
+		return
+	}
+
+	sess, ok := s.lookupSession(sessionID)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	transport, ok := sess.transport.(*chat.LongPollTransport)
+	if !ok {
+		http.Error(w, "Not a long-polling session", http.StatusBadRequest)
+		return
+	}
+
+	wait := defaultPollWait
+	if value := query.Get("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			http.Error(w, "wait must be a number of seconds", http.StatusBadRequest)
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+		if wait > maxPollWait {
+			wait = maxPollWait
+		}
+	}
+
+	frames, err := transport.Poll(r.Context(), wait)
+	if err != nil && !errors.Is(err, chat.ErrTransportClosed) {
+		return
+	}
+
+	resp := pollResponse{Session: sess.id, Frames: make([]json.RawMessage, 0, len(frames))}
+	for _, frame := range frames {
+		resp.Frames = append(resp.Frames, frame)
+	}
+	if errors.Is(err, chat.ErrTransportClosed) && len(frames) == 0 {
+		http.Error(w, "Session closed", http.StatusGone)
+		return
+	}
+	writePollResponse(w, resp)
+}
+
+func (s *Server) openPollSession(rooms []string, remoteAddr string) *session {
+	transport := chat.NewLongPollTransport(maxPollQueue)
+	participant := s.newParticipant(chat.NewTransportConnection(transport), remoteAddr)
+	sess := s.addSession(participant, transport)
+
+	transport.WriteMessage(chat.NewEvent(eventSession, "", map[string]string{
+		"session": sess.id,
+		"name":    participant.Name(),
+	}))
+	for _, roomID := range rooms {
+		if roomID = strings.TrimSpace(roomID); roomID == "" {
+			continue
+		}
+		if _, err := s.joinRoom(participant, roomID); err != nil {
+			transport.WriteMessage(chat.NewError(roomID, err.Error()))
+			continue
+		}
+	}
+
+	ttl := s.config.PollSessionTTL
+	if ttl <= 0 {
+		ttl = defaultPollTTL
+	}
+	go s.expirePollSession(sess, transport, ttl)
+	go func() {
+		s.handleParticipant(participant)
+		s.removeSession(sess.id)
+	}()
+
+	participant.Logger().Info("Long-poll session opened")
+	return sess
+}
+
+func (s *Server) expirePollSession(sess *session, transport *chat.LongPollTransport, ttl time.Duration) {
+	ticker := time.NewTicker(pollReaperFrequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-transport.Done():
+			return
+		case <-ticker.C:
+			if transport.Idle() > ttl {
+				sess.participant.Logger().Info("Long-poll session expired")
+				transport.Close()
+				return
+			}
+		}
+	}
+}
+
+// writePollResponse sends a fully buffered body with a Content-Length, which
+// is all that HTTP/1.0 clients understand.
+func writePollResponse(w http.ResponseWriter, resp pollResponse) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(resp); err != nil {
+		http.Error(w, "Could not encode frames", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(body.Bytes())
+}
@@ -1,6 +1,10 @@
 package server
 
-import "github.com/gorilla/mux"
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
 
 func (s *Server) Router() *mux.Router {
 	return s.router
@@ -8,6 +12,23 @@ func (s *Server) Router() *mux.Router {
 
 func (s *Server) routes() {
 	s.router.HandleFunc("/ws", s.handleWebSocket)
+	s.router.HandleFunc("/events", s.handleEvents).Methods("GET")
+	s.router.HandleFunc("/events/send", s.handleSessionSend).Methods("POST")
+	s.router.HandleFunc("/events/join", s.handleSessionJoin).Methods("POST")
+	s.router.HandleFunc("/poll", s.handlePoll).Methods("GET")
+	s.router.HandleFunc("/send", s.handleSessionSend).Methods("POST")
 	s.router.HandleFunc("/room/{roomID}", s.handleRoomCreation).Methods("POST")
+	s.router.Handle("/room/{roomID}", s.requireAPIKey(http.HandlerFunc(s.handleRoomUpdate))).Methods("PATCH")
+	s.router.Handle("/room/{roomID}", s.requireAPIKey(http.HandlerFunc(s.handleRoomDeletion))).Methods("DELETE")
+	s.router.HandleFunc("/room/{roomID}/members", s.handleListMembers).Methods("GET")
+	s.router.Handle("/room/{roomID}/webhooks", s.requireAPIKey(http.HandlerFunc(s.handleListWebhooks))).Methods("GET")
+	s.router.Handle("/room/{roomID}/webhooks", s.requireAPIKey(http.HandlerFunc(s.handleCreateWebhook))).Methods("POST")
+	s.router.Handle("/room/{roomID}/webhooks/dead", s.requireAPIKey(http.HandlerFunc(s.handleDeadLetters))).Methods("GET")
+	s.router.Handle("/room/{roomID}/webhooks/{webhookID}", s.requireAPIKey(http.HandlerFunc(s.handleDeleteWebhook))).Methods("DELETE")
+	s.router.HandleFunc("/room/{roomID}/messages", s.handleIngestMessage).Methods("POST")
+	s.router.Handle("/room/{roomID}/token", s.requireAPIKey(http.HandlerFunc(s.handleRotateIngestToken))).Methods("POST")
 	s.router.HandleFunc("/rooms", s.handleListRooms).Methods("GET")
+	s.router.Handle("/metrics", s.MetricsHandler()).Methods("GET")
+	s.router.HandleFunc("/healthz", s.handleHealthz).Methods("GET")
+	s.router.HandleFunc("/readyz", s.handleReadyz).Methods("GET")
 }
@@ -1,21 +1,105 @@
 package server
 
 import (
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"log/slog"
 	"net/http"
 	"sync"
+	"sync/atomic"
 
+	"chat/internal/backplane"
+	"chat/internal/bot"
 	"chat/internal/chat"
+	"chat/internal/cluster"
+	"chat/internal/command"
 	"chat/internal/config"
+	"chat/internal/filter"
+	"chat/internal/store"
+	"chat/internal/webhook"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
 
 type Server struct {
-	config *config.Config
-	router *mux.Router
-	rooms  map[string]*chat.Room
-	mu     sync.RWMutex
+	config   *config.Config
+	router   *mux.Router
+	rooms    *chat.RoomRegistry
+	mu       sync.RWMutex
+	filters  filter.Chain
+	commands *command.Registry
+	bots     []bot.Bot
+	botAPIs  []*botAPI
+	guests   uint64
+
+	ingestTokens map[string][sha256.Size]byte
+	store        store.MessageStore
+	sessions     map[string]*session
+	sessionsMu   sync.Mutex
+
+	upgrader  websocket.Upgrader
+	wsOptions chat.WebSocketOptions
+
+	participants   map[*chat.ChatParticipant]bool
+	participantsMu sync.Mutex
+
+	webhookQueue webhook.Queue
+	webhooks     *webhook.Dispatcher
+
+	node      string
+	backplane backplane.Backplane
+	cluster   *cluster.Cluster
+	replicas  *replicator
+	handoffs  sync.Map // room ID -> *handoff
+
+	draining atomic.Bool
+	readOnly atomic.Bool
+
+	stop         context.CancelFunc
+	webhooksDone chan struct{}
+}
+
+const (
+	defaultHistorySize = 1000
+	defaultBufferSize  = 1024
+)
+
+type Option func(*Server)
+
+// WithMessageStore replaces the in-memory history kept for every room.
+func WithMessageStore(messageStore store.MessageStore) Option {
+	return func(s *Server) {
+		s.store = messageStore
+	}
+}
+
+// WithMessageFilters appends filters to the chain run on every inbound chat
+// message, in the order given.
+func WithMessageFilters(filters ...filter.MessageFilter) Option {
+	return func(s *Server) {
+		s.filters = append(s.filters, filters...)
+	}
+}
+
+// WithCommands registers additional slash commands next to the built-in ones.
+func WithCommands(commands ...command.Command) Option {
+	return func(s *Server) {
+		for _, cmd := range commands {
+			if err := s.commands.Register(cmd); err != nil {
+				slog.Error("Error registering command", "error", err)
+			}
+		}
+	}
+}
+
+// WithBackplane connects the server's rooms to other server nodes, so members
+// connected to different nodes share one conversation.
+func WithBackplane(bp backplane.Backplane) Option {
+	return func(s *Server) {
+		s.backplane = bp
+	}
 }
 
 type ClientConnection struct {
@@ -24,20 +108,72 @@ type ClientConnection struct {
 	server *Server
 }
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+const defaultCompressionLevel = flate.BestSpeed
+
+func newUpgrader(cfg *config.Config) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:    orDefault(cfg.ReadBufferSize, defaultBufferSize),
+		WriteBufferSize:   orDefault(cfg.WriteBufferSize, defaultBufferSize),
+		EnableCompression: cfg.Compression,
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+}
+
+func webSocketOptions(cfg *config.Config) chat.WebSocketOptions {
+	level := cfg.CompressionLevel
+	if level == 0 {
+		level = defaultCompressionLevel
+	}
+	return chat.WebSocketOptions{
+		CompressionThreshold: cfg.CompressionThreshold,
+		CompressionLevel:     level,
+	}
+}
+
+func orDefault(n, def int) int {
+	if n > 0 {
+		return n
+	}
+	return def
 }
 
-func NewServer(cfg *config.Config) *Server {
+func NewServer(cfg *config.Config, opts ...Option) *Server {
 	s := &Server{
-		config: cfg,
-		router: mux.NewRouter(),
-		rooms:  make(map[string]*chat.Room),
+		config:   cfg,
+		router:   mux.NewRouter(),
+		rooms:    chat.NewRoomRegistry(),
+		commands: command.NewRegistry(),
+
+		ingestTokens: make(map[string][sha256.Size]byte),
+		store:        store.NewMemory(orDefault(cfg.HistorySize, defaultHistorySize)),
+		sessions:     make(map[string]*session),
+		upgrader:     newUpgrader(cfg),
+		wsOptions:    webSocketOptions(cfg),
+		node:         chat.NewMessageID(),
+		participants: make(map[*chat.ChatParticipant]bool),
+	}
+	s.registerBuiltinCommands()
+	for _, opt := range opts {
+		opt(s)
 	}
 	s.routes()
+	s.clusterRoutes()
+	s.adminRoutes()
+
+	ctx, stop := context.WithCancel(context.Background())
+	s.stop = stop
+	s.startWebhooks(ctx)
+	s.startCluster(ctx)
+	s.startBots()
 	return s
 }
+
+// Close stops the server's background work: cluster heartbeats and webhook
+// delivery. Deliveries not yet attempted stay in the webhook queue. Close
+// returns once the deliveries under way have finished.
+func (s *Server) Close() {
+	s.stop()
+	<-s.webhooksDone
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"chat/internal/chat"
+)
+
+const maxFrameSize = 64 << 10
+
+// sessionTransport is a transport whose inbound frames arrive over separate
+// HTTP requests.
+type sessionTransport interface {
+	chat.Transport
+	Push(frame []byte) error
+}
+
+// session ties an HTTP-based transport to its participant so that the
+// stateless POST endpoints can feed frames into the right connection.
+type session struct {
+	id          string
+	participant *chat.ChatParticipant
+	transport   sessionTransport
+}
+
+func (s *Server) addSession(participant *chat.ChatParticipant, transport sessionTransport) *session {
+	b := make([]byte, 16)
+	rand.Read(b)
+	sess := &session{
+		id:          hex.EncodeToString(b),
+		participant: participant,
+		transport:   transport,
+	}
+
+	s.sessionsMu.Lock()
+	s.sessions[sess.id] = sess
+	s.sessionsMu.Unlock()
+	return sess
+}
+
+func (s *Server) removeSession(id string) {
+	s.sessionsMu.Lock()
+	delete(s.sessions, id)
+	s.sessionsMu.Unlock()
+}
+
+func (s *Server) lookupSession(id string) (*session, bool) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	sess, ok := s.sessions[id]
+	return sess, ok
+}
+
+// handleSessionSend accepts any client frame for an HTTP session, exactly as
+// it would arrive over a WebSocket.
+func (s *Server) handleSessionSend(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.lookupSession(r.URL.Query().Get("session"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	frame, err := io.ReadAll(io.LimitReader(r.Body, maxFrameSize))
+	if err != nil || !json.Valid(frame) {
+		http.Error(w, "Body must be a JSON frame", http.StatusBadRequest)
+		return
+	}
+
+	s.pushFrame(w, sess, frame)
+}
+
+func (s *Server) handleSessionJoin(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.lookupSession(r.URL.Query().Get("session"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Room string `json:"room"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Room == "" {
+		http.Error(w, "Room is required", http.StatusBadRequest)
+		return
+	}
+
+	frame, _ := json.Marshal(map[string]string{"type": "join", "room": req.Room})
+	s.pushFrame(w, sess, frame)
+}
+
+func (s *Server) pushFrame(w http.ResponseWriter, sess *session, frame []byte) {
+	if err := sess.transport.Push(frame); err != nil {
+		http.Error(w, "Session closed", http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"chat/internal/chat"
+)
+
+const (
+	tcpMaxLineLength = 4096
+	tcpWriteTimeout  = 10 * time.Second
+	tcpGreeting      = "Welcome. Commands: JOIN room, LEAVE room, MSG room text, NICK name, QUIT"
+)
+
+// lineBreaks flattens user content onto the line it is written in, so that a
+// message cannot end the line early and forge protocol lines after it.
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ", "\x00", "")
+
+// ServeTCP accepts plain TCP clients speaking the newline-delimited text
+// protocol until the listener is closed.
+func (s *Server) ServeTCP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveLineClient(conn)
+	}
+}
+
+func (s *Server) serveLineClient(conn net.Conn) {
+	transport := newLineTransport(conn)
+	if s.Draining() {
+		transport.writeLine("ERR " + ErrDraining.Error())
+		transport.Close()
+		return
+	}
+	participant := s.newParticipant(chat.NewTransportConnection(transport), conn.RemoteAddr().String())
+
+	participant.Logger().Info("TCP client connected")
+	transport.writeLine(tcpGreeting)
+	transport.writeLine("You are " + participant.Name())
+
+	s.handleParticipant(participant)
+}
+
+// lineTransport translates between the text protocol and JSON frames, so TCP
+// clients go through the same participant and room code as everyone else.
+type lineTransport struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+	writeMu sync.Mutex
+	once    sync.Once
+}
+
+func newLineTransport(conn net.Conn) *lineTransport {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 512), tcpMaxLineLength)
+	return &lineTransport{conn: conn, scanner: scanner}
+}
+
+func (t *lineTransport) ReadMessage() ([]byte, error) {
+	for t.scanner.Scan() {
+		line := strings.TrimSpace(t.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		frame, err := parseLine(line)
+		if errors.Is(err, io.EOF) {
+			t.writeLine("BYE")
+			return nil, io.EOF
+		}
+		if err != nil {
+			t.writeLine("ERR " + err.Error())
+			continue
+		}
+		return json.Marshal(frame)
+	}
+
+	if err := t.scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// parseLine turns a protocol line into a client frame. QUIT is reported as
+// io.EOF.
+func parseLine(line string) (map[string]string, error) {
+	verb, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch strings.ToUpper(verb) {
+	case "JOIN", "LEAVE":
+		if rest == "" || strings.Contains(rest, " ") {
+			return nil, fmt.Errorf("usage: %s room", strings.ToUpper(verb))
+		}
+		return map[string]string{"type": strings.ToLower(verb), "room": rest}, nil
+	case "MSG":
+		room, text, ok := strings.Cut(rest, " ")
+		if !ok || room == "" || strings.TrimSpace(text) == "" {
+			return nil, errors.New("usage: MSG room text")
+		}
+		return map[string]string{"type": "chat", "room": room, "content": strings.TrimSpace(text)}, nil
+	case "NICK":
+		if rest == "" {
+			return nil, errors.New("usage: NICK name")
+		}
+		return map[string]string{"type": "nick", "name": rest}, nil
+	case "QUIT":
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("unknown command %s", verb)
+	}
+}
+
+func (t *lineTransport) WriteMessage(message []byte) error {
+	for _, line := range formatLines(message) {
+		if err := t.writeLine(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLines renders a server frame as human-readable lines. Only system
+// messages span more than one; their continuation lines are indented.
+func formatLines(message []byte) []string {
+	var frame struct {
+		Type    string                 `json:"type"`
+		Room    string                 `json:"room"`
+		Sender  string                 `json:"sender"`
+		Content string                 `json:"content"`
+		Data    map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(message, &frame); err != nil {
+		return []string{string(message)}
+	}
+
+	data := func(key string) string {
+		value, _ := frame.Data[key].(string)
+		return value
+	}
+
+	switch frame.Type {
+	case "chat":
+		return []string{fmt.Sprintf("[%s] %s: %s", frame.Room, frame.Sender, frame.Content)}
+	case chat.EventJoin:
+		return []string{fmt.Sprintf("[%s] * %s joined", frame.Room, data("name"))}
+	case chat.EventLeave:
+		return []string{fmt.Sprintf("[%s] * %s left", frame.Room, data("name"))}
+	case eventNick:
+		return []string{fmt.Sprintf("[%s] * %s is now known as %s", frame.Room, data("old"), data("new"))}
+	case eventAction:
+		return []string{fmt.Sprintf("[%s] * %s %s", frame.Room, frame.Sender, frame.Content)}
+	case eventKicked:
+		return []string{fmt.Sprintf("[%s] * %s was kicked: %s", frame.Room, data("name"), data("reason"))}
+	case chat.EventRoomUpdated:
+		if !topicChanged(frame.Data) {
+			return nil
+		}
+		return []string{fmt.Sprintf("[%s] * topic: %s", frame.Room, data("topic"))}
+	case chat.EventError:
+		return []string{"ERR " + data("reason")}
+	case "system":
+		lines := strings.Split(data("content"), "\n")
+		lines[0] = fmt.Sprintf("[%s] %s", frame.Room, lines[0])
+		for i := 1; i < len(lines); i++ {
+			lines[i] = "  " + lines[i]
+		}
+		return lines
+	default:
+		payload, _ := json.Marshal(frame.Data)
+		return []string{fmt.Sprintf("[%s] %s %s", frame.Room, frame.Type, payload)}
+	}
+}
+
+// topicChanged reports whether the data of a room update frame sets the
+// topic. Updates that only touch other metadata have nothing to show.
+func topicChanged(data map[string]interface{}) bool {
+	update, _ := data["update"].(map[string]interface{})
+	_, ok := update["topic"]
+	return ok
+}
+
+// writeLine writes line followed by CRLF. Any line breaks within line are
+// replaced, so it always reaches the client as exactly one line.
+func (t *lineTransport) writeLine(line string) error {
+	line = lineBreaks.Replace(line)
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	t.conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+	_, err := io.WriteString(t.conn, line+"\r\n")
+	return err
+}
+
+func (t *lineTransport) Close() error {
+	var err error
+	t.once.Do(func() {
+		err = t.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"context"
+
+	"chat/internal/chat"
+
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("chat/internal/server")
+
+// persist stores msg as part of its room's publish span, and queues it for
+// replication in a cluster.
+func (s *Server) persist(ctx context.Context, msg *chat.Message) error {
+	ctx, span := tracer.Start(ctx, "chat.persist")
+	err := s.store.Append(ctx, msg)
+	if err == nil {
+		s.replicate(msg)
+	}
+	chat.EndSpan(span, err)
+	return err
+}
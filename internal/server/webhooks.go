@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"chat/internal/chat"
+	"chat/internal/logging"
+	"chat/internal/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// WithWebhookQueue replaces the in-memory webhook queue, typically with a
+// webhook.DirQueue so subscriptions and pending deliveries survive restarts.
+func WithWebhookQueue(queue webhook.Queue) Option {
+	return func(s *Server) {
+		s.webhookQueue = queue
+	}
+}
+
+func (s *Server) startWebhooks(ctx context.Context) {
+	if s.webhookQueue == nil {
+		s.webhookQueue = webhook.NewMemoryQueue()
+	}
+	s.webhooks = webhook.NewDispatcher(s.webhookQueue, webhook.Options{
+		MaxAttempts: s.config.WebhookMaxAttempts,
+		Backoff:     s.config.WebhookBackoff,
+	})
+	s.webhooksDone = make(chan struct{})
+	go func() {
+		defer close(s.webhooksDone)
+		s.webhooks.Run(ctx)
+	}()
+}
+
+// emit notifies webhook subscribers of a room event.
+func (s *Server) emit(eventType, roomID string, data interface{}) {
+	s.webhooks.Publish(eventType, roomID, data)
+}
+
+// emitContext is emit for an event caused by a traced operation; the
+// deliveries continue its trace.
+func (s *Server) emitContext(ctx context.Context, eventType, roomID string, data interface{}) {
+	s.webhooks.PublishContext(ctx, eventType, roomID, data)
+}
+
+type createWebhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	roomID := mux.Vars(r)["roomID"]
+	if _, ok := s.lookupRoom(roomID); !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.webhooks.Subscriptions(roomID))
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	roomID := mux.Vars(r)["roomID"]
+	if _, ok := s.lookupRoom(roomID); !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid webhook", http.StatusBadRequest)
+		return
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		http.Error(w, "Webhook URL must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	for _, eventType := range req.Events {
+		if !validWebhookEvent(eventType) {
+			http.Error(w, "Unknown webhook event "+eventType, http.StatusBadRequest)
+			return
+		}
+	}
+
+	sub := s.webhooks.Subscribe(webhook.Subscription{
+		Room:   roomID,
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: req.Events,
+	})
+	requestLogger(r).Info("Webhook registered", logging.Room(roomID), "webhook_id", sub.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !s.webhooks.Unsubscribe(vars["roomID"], vars["webhookID"]) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	requestLogger(r).Info("Webhook removed", logging.Room(vars["roomID"]), "webhook_id", vars["webhookID"])
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	roomID := mux.Vars(r)["roomID"]
+	deliveries, err := s.webhooks.DeadLetters(roomID)
+	if err != nil {
+		slog.Error("Error reading dead letters", logging.Room(roomID), "error", err)
+		http.Error(w, "Could not read dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func (s *Server) lookupRoom(roomID string) (*chat.Room, bool) {
+	return s.rooms.Get(roomID)
+}
+
+func validWebhookEvent(eventType string) bool {
+	for _, e := range webhook.EventTypes {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
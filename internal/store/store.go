@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"chat/internal/chat"
+)
+
+// MessageStore keeps the chat history of each room, ordered by sequence
+// number.
+type MessageStore interface {
+	Append(ctx context.Context, msg *chat.Message) error
+	// Since returns up to limit messages of the room with a sequence number
+	// greater than seq, oldest first.
+	Since(ctx context.Context, roomID string, seq uint64, limit int) ([]*chat.Message, error)
+	// Delete drops the room's history.
+	Delete(ctx context.Context, roomID string) error
+}
+
+// Memory keeps the most recent messages of every room in memory.
+type Memory struct {
+	perRoom int
+	mu      sync.RWMutex
+	rooms   map[string][]*chat.Message
+}
+
+func NewMemory(perRoom int) *Memory {
+	return &Memory{
+		perRoom: perRoom,
+		rooms:   make(map[string][]*chat.Message),
+	}
+}
+
+func (m *Memory) Append(ctx context.Context, msg *chat.Message) error {
+	copied := *msg
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Trimming only once the slice holds twice the limit keeps appends
+	// amortised O(1); Since never looks past the last perRoom entries.
+	history := append(m.rooms[msg.Room], &copied)
+	if len(history) > 2*m.perRoom {
+		history = append(history[:0:0], history[len(history)-m.perRoom:]...)
+	}
+	m.rooms[msg.Room] = history
+	return nil
+}
+
+func (m *Memory) Since(ctx context.Context, roomID string, seq uint64, limit int) ([]*chat.Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	history := m.rooms[roomID]
+	if len(history) > m.perRoom {
+		history = history[len(history)-m.perRoom:]
+	}
+	start := sort.Search(len(history), func(i int) bool {
+		return history[i].Seq > seq
+	})
+	end := len(history)
+	if limit > 0 && end-start > limit {
+		end = start + limit
+	}
+
+	messages := make([]*chat.Message, 0, end-start)
+	for _, msg := range history[start:end] {
+		copied := *msg
+		messages = append(messages, &copied)
+	}
+	return messages, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, roomID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rooms, roomID)
+	return nil
+}
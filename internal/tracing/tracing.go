@@ -0,0 +1,95 @@
+// Package tracing configures OpenTelemetry and carries W3C trace context
+// across the places a message leaves the process: client frames, webhook
+// deliveries and requests between cluster nodes.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderTraceParent is the W3C header, and frame field, holding the trace
+// context.
+const HeaderTraceParent = "traceparent"
+
+var propagator = propagation.TraceContext{}
+
+type Options struct {
+	ServiceName string
+
+	// Endpoint is the OTLP/HTTP collector address, host:port.
+	Endpoint string
+	Insecure bool
+
+	// SampleRatio is the fraction of new traces recorded. Requests from
+	// other nodes follow the sampling decision of the node that started the
+	// trace; trace context from clients is only linked, see Link.
+	SampleRatio float64
+}
+
+// Setup installs a global tracer provider exporting over OTLP. The returned
+// function flushes pending spans and must be called before exiting.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	exporterOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(opts.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return provider.Shutdown, nil
+}
+
+// WithTraceParent returns ctx carrying the remote span described by a
+// traceparent value. An empty or malformed value leaves ctx unchanged.
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{HeaderTraceParent: traceparent})
+}
+
+// Link returns options that start a span as the root of a new trace, linked
+// to the remote span in ctx if there is one. Trace context from clients is
+// recorded this way rather than continued, so that clients, who choose their
+// trace IDs and sampled flags, cannot decide what the server samples.
+func Link(ctx context.Context) []trace.SpanStartOption {
+	opts := []trace.SpanStartOption{trace.WithNewRoot()}
+	if remote := trace.SpanContextFromContext(ctx); remote.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: remote}))
+	}
+	return opts
+}
+
+// TraceParent formats the span in ctx as a traceparent value, or returns the
+// empty string if ctx has no valid span.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier[HeaderTraceParent]
+}
+
+func InjectHeader(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+func ExtractHeader(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,456 @@
+package webhook
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"chat/internal/logging"
+	"chat/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("chat/internal/webhook")
+
+const (
+	defaultMaxAttempts = 8
+	defaultBackoff     = time.Second
+	maxBackoff         = 10 * time.Minute
+	pollInterval       = time.Second
+	maxInFlight        = 8
+)
+
+type Options struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	Client      *http.Client
+}
+
+// Dispatcher fans room events out to subscriptions and delivers them from its
+// queue, retrying failed deliveries with exponential backoff until they run
+// out of attempts and are moved to the dead-letter list. The queue is read
+// once when Run starts; from then on the dispatcher schedules deliveries from
+// memory and only writes changes through to the queue.
+type Dispatcher struct {
+	queue       Queue
+	store       SubscriptionStore
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+
+	mu            sync.RWMutex
+	subscriptions map[string]map[string]*Subscription
+
+	// incoming holds deliveries published but not yet queued; due holds the
+	// queued ones that are not being attempted, soonest first.
+	dueMu    sync.Mutex
+	incoming []*Delivery
+	due      dueHeap
+
+	slots   chan struct{}
+	wake    chan struct{}
+	workers sync.WaitGroup
+}
+
+func NewDispatcher(queue Queue, opts Options) *Dispatcher {
+	d := &Dispatcher{
+		queue:         queue,
+		client:        opts.Client,
+		maxAttempts:   opts.MaxAttempts,
+		backoff:       opts.Backoff,
+		subscriptions: make(map[string]map[string]*Subscription),
+		slots:         make(chan struct{}, maxInFlight),
+		wake:          make(chan struct{}, 1),
+	}
+	if d.client == nil {
+		d.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = defaultMaxAttempts
+	}
+	if d.backoff <= 0 {
+		d.backoff = defaultBackoff
+	}
+	if store, ok := queue.(SubscriptionStore); ok {
+		d.store = store
+		d.loadSubscriptions()
+	}
+	return d
+}
+
+func (d *Dispatcher) loadSubscriptions() {
+	subs, err := d.store.Subscriptions()
+	if err != nil {
+		slog.Error("Error loading webhook subscriptions", "error", err)
+		return
+	}
+	for _, sub := range subs {
+		if d.subscriptions[sub.Room] == nil {
+			d.subscriptions[sub.Room] = make(map[string]*Subscription)
+		}
+		d.subscriptions[sub.Room][sub.ID] = sub
+	}
+}
+
+func (d *Dispatcher) Subscribe(sub Subscription) *Subscription {
+	sub.ID = newID()
+	sub.CreatedAt = time.Now()
+	if sub.Secret == "" {
+		sub.Secret = NewSecret()
+	}
+
+	d.mu.Lock()
+	if d.subscriptions[sub.Room] == nil {
+		d.subscriptions[sub.Room] = make(map[string]*Subscription)
+	}
+	d.subscriptions[sub.Room][sub.ID] = &sub
+	copied := sub
+	d.mu.Unlock()
+
+	if d.store != nil {
+		if err := d.store.SaveSubscription(&copied); err != nil {
+			slog.Error("Error saving webhook subscription", logging.Room(sub.Room), "webhook_id", sub.ID, "error", err)
+		}
+	}
+	return &copied
+}
+
+func (d *Dispatcher) Unsubscribe(roomID, id string) bool {
+	d.mu.Lock()
+	if _, ok := d.subscriptions[roomID][id]; !ok {
+		d.mu.Unlock()
+		return false
+	}
+	delete(d.subscriptions[roomID], id)
+	if len(d.subscriptions[roomID]) == 0 {
+		delete(d.subscriptions, roomID)
+	}
+	d.mu.Unlock()
+
+	d.forget(roomID, id)
+	return true
+}
+
+// UnsubscribeRoom removes every subscription to the room and returns how many
+// there were. Deliveries already queued are still attempted.
+func (d *Dispatcher) UnsubscribeRoom(roomID string) int {
+	d.mu.Lock()
+	subs := d.subscriptions[roomID]
+	delete(d.subscriptions, roomID)
+	d.mu.Unlock()
+
+	for id := range subs {
+		d.forget(roomID, id)
+	}
+	return len(subs)
+}
+
+func (d *Dispatcher) forget(roomID, id string) {
+	if d.store == nil {
+		return
+	}
+	if err := d.store.DeleteSubscription(id); err != nil {
+		slog.Error("Error deleting webhook subscription", logging.Room(roomID), "webhook_id", id, "error", err)
+	}
+}
+
+// Subscriptions lists a room's subscriptions with their secrets removed.
+func (d *Dispatcher) Subscriptions(roomID string) []Subscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	subs := make([]Subscription, 0, len(d.subscriptions[roomID]))
+	for _, sub := range d.subscriptions[roomID] {
+		copied := *sub
+		copied.Secret = ""
+		subs = append(subs, copied)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+	})
+	return subs
+}
+
+// DeadLetters lists the deliveries for a room that exhausted their attempts.
+func (d *Dispatcher) DeadLetters(roomID string) ([]Delivery, error) {
+	dead, err := d.queue.Dead()
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]Delivery, 0)
+	for _, delivery := range dead {
+		if delivery.Room == roomID {
+			delivery.Secret = ""
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+// Publish queues a delivery of the event for every interested subscription.
+func (d *Dispatcher) Publish(eventType, roomID string, data interface{}) {
+	d.PublishContext(context.Background(), eventType, roomID, data)
+}
+
+// PublishContext is Publish for an event caused by the traced operation in
+// ctx. Deliveries carry its trace context to the receiver. The deliveries are
+// handed to Run, which queues them, so publishing never waits on the queue.
+func (d *Dispatcher) PublishContext(ctx context.Context, eventType, roomID string, data interface{}) {
+	d.mu.RLock()
+	var subs []Subscription
+	for _, sub := range d.subscriptions[roomID] {
+		if sub.Wants(eventType) {
+			subs = append(subs, *sub)
+		}
+	}
+	d.mu.RUnlock()
+	if len(subs) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(Event{
+		ID:   newID(),
+		Type: eventType,
+		Room: roomID,
+		Time: time.Now(),
+		Data: data,
+	})
+	if err != nil {
+		slog.Error("Error marshaling webhook event", "type", eventType, logging.Room(roomID), "error", err)
+		return
+	}
+
+	d.dueMu.Lock()
+	for _, sub := range subs {
+		d.incoming = append(d.incoming, &Delivery{
+			ID:             newID(),
+			SubscriptionID: sub.ID,
+			Room:           roomID,
+			URL:            sub.URL,
+			Secret:         sub.Secret,
+			EventType:      eventType,
+			Payload:        payload,
+			NextAttempt:    time.Now(),
+			TraceParent:    tracing.TraceParent(ctx),
+		})
+	}
+	d.dueMu.Unlock()
+	d.notify()
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers queued events until ctx is cancelled. It then queues what was
+// published in the meantime and waits for the attempts under way.
+func (d *Dispatcher) Run(ctx context.Context) {
+	pending, err := d.queue.Pending()
+	if err != nil {
+		slog.Error("Error reading webhook queue", "error", err)
+	}
+	d.dueMu.Lock()
+	for _, delivery := range pending {
+		heap.Push(&d.due, delivery)
+	}
+	d.dueMu.Unlock()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.queueIncoming()
+			d.workers.Wait()
+			return
+		case <-timer.C:
+		case <-d.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+
+		d.queueIncoming()
+		timer.Reset(d.dispatchDue(ctx))
+	}
+}
+
+// queueIncoming writes newly published deliveries to the queue and schedules
+// them.
+func (d *Dispatcher) queueIncoming() {
+	d.dueMu.Lock()
+	incoming := d.incoming
+	d.incoming = nil
+	d.dueMu.Unlock()
+
+	for _, delivery := range incoming {
+		if err := d.queue.Put(delivery); err != nil {
+			slog.Error("Error queueing webhook delivery", logging.Room(delivery.Room), "url", delivery.URL, "error", err)
+			continue
+		}
+		d.schedule(delivery)
+	}
+}
+
+func (d *Dispatcher) schedule(delivery *Delivery) {
+	d.dueMu.Lock()
+	heap.Push(&d.due, delivery)
+	d.dueMu.Unlock()
+}
+
+// dispatchDue starts every delivery that is due and returns how long to wait
+// before the next one.
+func (d *Dispatcher) dispatchDue(ctx context.Context) time.Duration {
+	for {
+		d.dueMu.Lock()
+		if len(d.due) == 0 {
+			d.dueMu.Unlock()
+			return pollInterval
+		}
+		if until := time.Until(d.due[0].NextAttempt); until > 0 {
+			d.dueMu.Unlock()
+			return min(until, pollInterval)
+		}
+		delivery := heap.Pop(&d.due).(*Delivery)
+		d.dueMu.Unlock()
+
+		select {
+		case d.slots <- struct{}{}:
+		case <-ctx.Done():
+			d.schedule(delivery)
+			return pollInterval
+		}
+		d.workers.Add(1)
+		go func() {
+			defer func() {
+				<-d.slots
+				d.workers.Done()
+			}()
+			d.attempt(ctx, delivery)
+		}()
+	}
+}
+
+// dueHeap orders deliveries by their next attempt.
+type dueHeap []*Delivery
+
+func (h dueHeap) Len() int           { return len(h) }
+func (h dueHeap) Less(i, j int) bool { return h[i].NextAttempt.Before(h[j].NextAttempt) }
+func (h dueHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *dueHeap) Push(x interface{}) {
+	*h = append(*h, x.(*Delivery))
+}
+
+func (h *dueHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	delivery := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return delivery
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	logger := slog.With("delivery_id", delivery.ID, logging.Room(delivery.Room), "url", delivery.URL)
+	delivery.Attempts++
+	err := d.send(ctx, delivery)
+	if err == nil {
+		if err := d.queue.Remove(delivery.ID); err != nil {
+			logger.Error("Error removing webhook delivery", "error", err)
+		}
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.maxAttempts {
+		logger.Warn("Webhook delivery failed permanently", "attempts", delivery.Attempts, "error", err)
+		if err := d.queue.Bury(delivery); err != nil {
+			logger.Error("Error moving webhook delivery to dead letters", "error", err)
+		}
+		return
+	}
+
+	delivery.NextAttempt = time.Now().Add(d.backoffFor(delivery.Attempts))
+	logger.Info("Webhook delivery failed, retrying",
+		"attempts", delivery.Attempts, "next_attempt", delivery.NextAttempt, "error", err)
+	if err := d.queue.Put(delivery); err != nil {
+		logger.Error("Error rescheduling webhook delivery", "error", err)
+	}
+	d.schedule(delivery)
+	d.notify()
+}
+
+func (d *Dispatcher) backoffFor(attempts int) time.Duration {
+	backoff := d.backoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *Delivery) (err error) {
+	ctx, span := tracer.Start(tracing.WithTraceParent(ctx, delivery.TraceParent), "webhook.deliver",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("webhook.delivery_id", delivery.ID),
+			attribute.String("webhook.event", delivery.EventType),
+			attribute.Int("webhook.attempt", delivery.Attempts),
+			attribute.String("url.full", delivery.URL),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	tracing.InjectHeader(ctx, req.Header)
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
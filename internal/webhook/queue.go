@@ -0,0 +1,302 @@
+package webhook
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Queue stores deliveries that still have to be attempted and the ones that
+// ran out of attempts.
+type Queue interface {
+	Put(d *Delivery) error
+	Remove(id string) error
+	Pending() ([]*Delivery, error)
+	Bury(d *Delivery) error
+	Dead() ([]*Delivery, error)
+}
+
+// SubscriptionStore is implemented by queues that also keep subscriptions,
+// so that a restart loses neither the deliveries nor the subscriptions that
+// produce new ones.
+type SubscriptionStore interface {
+	SaveSubscription(sub *Subscription) error
+	DeleteSubscription(id string) error
+	Subscriptions() ([]*Subscription, error)
+}
+
+type MemoryQueue struct {
+	mu      sync.Mutex
+	pending map[string]*Delivery
+	dead    map[string]*Delivery
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		pending: make(map[string]*Delivery),
+		dead:    make(map[string]*Delivery),
+	}
+}
+
+func (q *MemoryQueue) Put(d *Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	copied := *d
+	q.pending[d.ID] = &copied
+	return nil
+}
+
+func (q *MemoryQueue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.pending, id)
+	return nil
+}
+
+func (q *MemoryQueue) Pending() ([]*Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return sortedDeliveries(q.pending), nil
+}
+
+func (q *MemoryQueue) Bury(d *Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.pending, d.ID)
+	copied := *d
+	q.dead[d.ID] = &copied
+	return nil
+}
+
+func (q *MemoryQueue) Dead() ([]*Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return sortedDeliveries(q.dead), nil
+}
+
+// ErrNoQueueKey is returned by NewDirQueue when no key is given.
+var ErrNoQueueKey = errors.New("webhook queue key is required")
+
+// DirQueue keeps one JSON file per delivery under dir/pending and dir/dead,
+// and one per subscription under dir/subscriptions, so both survive a
+// restart. Subscription secrets are sealed with AES-GCM under a key derived
+// from the queue key, so reading the files is not enough to forge deliveries.
+type DirQueue struct {
+	pendingDir      string
+	deadDir         string
+	subscriptionDir string
+	aead            cipher.AEAD
+	mu              sync.Mutex
+}
+
+func NewDirQueue(dir, key string) (*DirQueue, error) {
+	if key == "" {
+		return nil, ErrNoQueueKey
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &DirQueue{
+		pendingDir:      filepath.Join(dir, "pending"),
+		deadDir:         filepath.Join(dir, "dead"),
+		subscriptionDir: filepath.Join(dir, "subscriptions"),
+		aead:            aead,
+	}
+	for _, d := range []string{q.pendingDir, q.deadDir, q.subscriptionDir} {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func (q *DirQueue) Put(d *Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.write(q.pendingDir, d)
+}
+
+func (q *DirQueue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err := os.Remove(filepath.Join(q.pendingDir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (q *DirQueue) Pending() ([]*Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.read(q.pendingDir)
+}
+
+func (q *DirQueue) Bury(d *Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.write(q.deadDir, d); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(q.pendingDir, d.ID+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (q *DirQueue) Dead() ([]*Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.read(q.deadDir)
+}
+
+func (q *DirQueue) SaveSubscription(sub *Subscription) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	sealed := *sub
+	sealed.Secret = q.seal(sub.Secret, sub.ID)
+	return writeFile(q.subscriptionDir, sub.ID, &sealed)
+}
+
+func (q *DirQueue) DeleteSubscription(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err := os.Remove(filepath.Join(q.subscriptionDir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (q *DirQueue) Subscriptions() ([]*Subscription, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(q.subscriptionDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]*Subscription, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var sub Subscription
+		if err := json.Unmarshal(data, &sub); err != nil {
+			continue
+		}
+		if sub.Secret, err = q.open(sub.Secret, sub.ID); err != nil {
+			slog.Warn("Skipping webhook subscription sealed with another key", "path", path, "error", err)
+			continue
+		}
+		subs = append(subs, &sub)
+	}
+	return subs, nil
+}
+
+// seal encrypts a secret, bound to the ID of the delivery or subscription it
+// belongs to so it cannot be moved to another file.
+func (q *DirQueue) seal(secret, id string) string {
+	nonce := make([]byte, q.aead.NonceSize())
+	rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(q.aead.Seal(nonce, nonce, []byte(secret), []byte(id)))
+}
+
+func (q *DirQueue) open(secret, id string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < q.aead.NonceSize() {
+		return "", errors.New("sealed secret is too short")
+	}
+	nonce, ciphertext := sealed[:q.aead.NonceSize()], sealed[q.aead.NonceSize():]
+	opened, err := q.aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", err
+	}
+	return string(opened), nil
+}
+
+func (q *DirQueue) write(dir string, d *Delivery) error {
+	sealed := *d
+	sealed.Secret = q.seal(d.Secret, d.ID)
+	return writeFile(dir, d.ID, &sealed)
+}
+
+// writeFile writes through a temporary file and a rename so that a crash
+// never leaves a half-written file behind.
+func writeFile(dir, id string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, id+".json"))
+}
+
+func (q *DirQueue) read(dir string) ([]*Delivery, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make(map[string]*Delivery, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var d Delivery
+		if err := json.Unmarshal(data, &d); err != nil {
+			continue
+		}
+		if d.Secret, err = q.open(d.Secret, d.ID); err != nil {
+			slog.Warn("Skipping webhook delivery sealed with another key", "path", path, "error", err)
+			continue
+		}
+		deliveries[d.ID] = &d
+	}
+	return sortedDeliveries(deliveries), nil
+}
+
+func sortedDeliveries(deliveries map[string]*Delivery) []*Delivery {
+	list := make([]*Delivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		copied := *d
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].NextAttempt.Before(list[j].NextAttempt)
+	})
+	return list
+}
@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	EventMessage     = "message"
+	EventJoin        = "join"
+	EventLeave       = "leave"
+	EventRoomCreated = "room.created"
+	EventRoomUpdated = "room.updated"
+	EventRoomDeleted = "room.deleted"
+
+	HeaderSignature = "X-Chat-Signature"
+	HeaderTimestamp = "X-Chat-Timestamp"
+	HeaderEvent     = "X-Chat-Event"
+	HeaderDelivery  = "X-Chat-Delivery"
+)
+
+var EventTypes = []string{
+	EventMessage,
+	EventJoin,
+	EventLeave,
+	EventRoomCreated,
+	EventRoomUpdated,
+	EventRoomDeleted,
+}
+
+type Subscription struct {
+	ID        string    `json:"id"`
+	Room      string    `json:"room"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the subscription listens to eventType. An empty
+// event list subscribes to everything.
+func (s *Subscription) Wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the JSON body posted to subscribers.
+type Event struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Room string      `json:"room"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Delivery is one attempt-tracked POST of an event to one subscription.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	Room           string          `json:"room"`
+	URL            string          `json:"url"`
+	Secret         string          `json:"secret"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	NextAttempt    time.Time       `json:"next_attempt"`
+	LastError      string          `json:"last_error,omitempty"`
+
+	// TraceParent is the trace context of the operation that caused the
+	// event; it is sent on every attempt.
+	TraceParent string `json:"traceparent,omitempty"`
+}
+
+// Sign computes the signature header value for a delivery body. The signed
+// string is the timestamp header, a dot and the raw body, so receivers can
+// reject replayed requests.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func NewSecret() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
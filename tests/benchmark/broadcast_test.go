@@ -0,0 +1,156 @@
+package benchmark
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/internal/chat"
+
+	"github.com/gorilla/websocket"
+)
+
+const broadcastMembers = 10000
+
+// discardConn is a client that is never slow and never talks back, so the
+// benchmark measures only the server's framing and compression work.
+type discardConn struct{}
+
+func (discardConn) Read(p []byte) (int, error)         { return 0, io.EOF }
+func (discardConn) Write(p []byte) (int, error)        { return len(p), nil }
+func (discardConn) Close() error                       { return nil }
+func (discardConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (discardConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (discardConn) SetDeadline(t time.Time) error      { return nil }
+func (discardConn) SetReadDeadline(t time.Time) error  { return nil }
+func (discardConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn := discardConn{}
+	return conn, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), nil
+}
+
+func newTransports(b *testing.B, n int, compress bool) []*chat.WebSocketTransport {
+	b.Helper()
+
+	upgrader := websocket.Upgrader{EnableCompression: compress}
+	transports := make([]*chat.WebSocketTransport, 0, n)
+	for i := 0; i < n; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		if compress {
+			r.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate")
+		}
+		conn, err := upgrader.Upgrade(hijackRecorder{httptest.NewRecorder()}, r, nil)
+		if err != nil {
+			b.Fatalf("Failed to upgrade: %v", err)
+		}
+		transports = append(transports, chat.NewWebSocketTransport(conn, chat.WebSocketOptions{
+			Compress:         compress,
+			CompressionLevel: flate.BestSpeed,
+		}))
+	}
+	return transports
+}
+
+func broadcastPayload(i int) []byte {
+	msg := &chat.Message{
+		ID:      chat.NewMessageID(),
+		Seq:     uint64(i + 1),
+		Type:    "chat",
+		Room:    "lobby",
+		Content: fmt.Sprintf("message %d: %s", i, strings.Repeat("the quick brown fox jumps over the lazy dog ", 8)),
+		Sender:  "guest-1",
+	}
+	payload, _ := msg.Marshal()
+	return payload
+}
+
+// BenchmarkBroadcast delivers one room message to 10k WebSocket members. The
+// per-recipient case is how broadcasts were written before frames were
+// prepared: every member frames, and compresses, its own copy.
+func BenchmarkBroadcast(b *testing.B) {
+	for _, compress := range []bool{false, true} {
+		transports := newTransports(b, broadcastMembers, compress)
+
+		b.Run(fmt.Sprintf("per-recipient/compress=%t", compress), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				payload := broadcastPayload(i)
+				for _, t := range transports {
+					if err := t.WriteMessage(payload); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("prepared/compress=%t", compress), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				frame := chat.NewBroadcastFrame(broadcastPayload(i))
+				for _, t := range transports {
+					if err := t.WriteFrame(frame, chat.JSONCodec); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+const broadcastBatch = 8
+
+// BenchmarkBatchedBroadcast delivers a batch of room messages to 10k members
+// that opted into batched frames. The per-recipient case joins and frames the
+// batch for every member, as batched writes did before they were prepared.
+func BenchmarkBatchedBroadcast(b *testing.B) {
+	for _, compress := range []bool{false, true} {
+		transports := newTransports(b, broadcastMembers, compress)
+
+		b.Run(fmt.Sprintf("per-recipient/compress=%t", compress), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				payloads := make([][]byte, broadcastBatch)
+				for j := range payloads {
+					payloads[j] = broadcastPayload(i*broadcastBatch + j)
+				}
+				for _, t := range transports {
+					if err := t.WriteMessage(bytes.Join(payloads, []byte("\n"))); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("prepared/compress=%t", compress), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				frames := make([]*chat.Frame, broadcastBatch)
+				for j := range frames {
+					frames[j] = chat.NewBroadcastFrame(broadcastPayload(i*broadcastBatch + j))
+				}
+				for _, t := range transports {
+					if err := t.WriteBatch(frames, chat.BatchLines, chat.JSONCodec); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package benchmark
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"chat/internal/chat"
+)
+
+const registryRooms = 100000
+
+// lockedRegistry is the single map behind one RWMutex that the server used
+// before rooms were sharded; it is kept here as the baseline.
+type lockedRegistry struct {
+	mu    sync.RWMutex
+	rooms map[string]*chat.Room
+}
+
+func (r *lockedRegistry) GetOrCreate(id string, create func() *chat.Room) (*chat.Room, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if room, ok := r.rooms[id]; ok {
+		return room, false
+	}
+	room := create()
+	r.rooms[id] = room
+	return room, true
+}
+
+type registry interface {
+	GetOrCreate(id string, create func() *chat.Room) (*chat.Room, bool)
+}
+
+func roomIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("room-%d", i)
+	}
+	return ids
+}
+
+func populate(reg registry, ids []string) {
+	for _, id := range ids {
+		id := id
+		reg.GetOrCreate(id, func() *chat.Room { return chat.NewRoom(id) })
+	}
+}
+
+// BenchmarkRoomJoin measures the room lookup done by every join, spread over
+// 100k existing rooms, and the creation of rooms that do not exist yet.
+func BenchmarkRoomJoin(b *testing.B) {
+	ids := roomIDs(registryRooms)
+	registries := []struct {
+		name string
+		new  func() registry
+	}{
+		{"mutex", func() registry { return &lockedRegistry{rooms: make(map[string]*chat.Room)} }},
+		{"sharded", func() registry { return chat.NewRoomRegistry() }},
+	}
+
+	for _, r := range registries {
+		b.Run(r.name+"/existing", func(b *testing.B) {
+			reg := r.new()
+			populate(reg, ids)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					id := ids[rng.Intn(len(ids))]
+					reg.GetOrCreate(id, func() *chat.Room { return chat.NewRoom(id) })
+				}
+			})
+		})
+
+		b.Run(r.name+"/create", func(b *testing.B) {
+			reg := r.new()
+			var next atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					id := fmt.Sprintf("new-%d", next.Add(1))
+					reg.GetOrCreate(id, func() *chat.Room { return chat.NewRoom(id) })
+				}
+			})
+		})
+	}
+}
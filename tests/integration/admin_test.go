@@ -0,0 +1,188 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/internal/config"
+	"chat/internal/server"
+)
+
+const adminKey = "admin-secret"
+
+func adminRequest(t *testing.T, ts *httptest.Server, method, path, key, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to %s %s: %v", method, path, err)
+	}
+	return resp
+}
+
+func adminConnections(t *testing.T, ts *httptest.Server, path string) []server.ConnectionInfo {
+	t.Helper()
+
+	resp := adminRequest(t, ts, http.MethodGet, path, adminKey, "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 from %s, got %s", path, resp.Status)
+	}
+	var connections []server.ConnectionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&connections); err != nil {
+		t.Fatalf("Failed to decode connections: %v", err)
+	}
+	return connections
+}
+
+func TestAdminAuthentication(t *testing.T) {
+	closed := httptest.NewServer(server.NewServer(&config.Config{Address: ":8080"}).Router())
+	defer closed.Close()
+	resp := adminRequest(t, closed, http.MethodGet, "/admin/connections", adminKey, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected the admin API to be closed without admin keys, got %s", resp.Status)
+	}
+
+	ts := httptest.NewServer(server.NewServer(&config.Config{Address: ":8080", AdminKeys: []string{adminKey}}).Router())
+	defer ts.Close()
+	for _, key := range []string{"", "wrong"} {
+		resp := adminRequest(t, ts, http.MethodGet, "/admin/connections", key, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for key %q, got %s", key, resp.Status)
+		}
+	}
+}
+
+func TestAdminAPI(t *testing.T) {
+	s := server.NewServer(&config.Config{Address: ":8080", AdminKeys: []string{adminKey}})
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	alice := dialWebSocket(t, ts)
+	defer alice.Close()
+	bob := dialWebSocket(t, ts)
+	defer bob.Close()
+	joinAndWait(t, ts, alice, "lobby", 1)
+	joinAndWait(t, ts, bob, "lobby", 2)
+
+	connections := adminConnections(t, ts, "/admin/connections")
+	if len(connections) != 2 {
+		t.Fatalf("Expected 2 connections, got %+v", connections)
+	}
+	for _, conn := range connections {
+		if conn.ID == "" || conn.RemoteAddr == "" || conn.User == "" || conn.ConnectedAt.IsZero() {
+			t.Errorf("Incomplete connection info: %+v", conn)
+		}
+		if len(conn.Rooms) != 1 || conn.Rooms[0] != "lobby" {
+			t.Errorf("Expected %s to be in the lobby, got %v", conn.User, conn.Rooms)
+		}
+	}
+	if connections[1].ConnectedAt.Before(connections[0].ConnectedAt) {
+		t.Errorf("Expected connections oldest first, got %+v", connections)
+	}
+
+	if members := adminConnections(t, ts, "/admin/rooms/lobby/members"); len(members) != 2 {
+		t.Errorf("Expected 2 lobby members, got %+v", members)
+	}
+	resp := adminRequest(t, ts, http.MethodGet, "/admin/rooms/nowhere/members", adminKey, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown room, got %s", resp.Status)
+	}
+
+	resp = adminRequest(t, ts, http.MethodPost, "/admin/announcements", adminKey, `{"content":"restarting soon"}`)
+	var announced struct {
+		Rooms int `json:"rooms"`
+	}
+	json.NewDecoder(resp.Body).Decode(&announced)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || announced.Rooms != 1 {
+		t.Errorf("Expected the announcement to reach 1 room, got %s %+v", resp.Status, announced)
+	}
+	for _, frame := range []map[string]interface{}{readFrame(t, alice), readFrame(t, bob)} {
+		data, _ := frame["data"].(map[string]interface{})
+		if frame["type"] != "system" || data["content"] != "restarting soon" {
+			t.Errorf("Expected a system announcement, got %v", frame)
+		}
+	}
+
+	resp = adminRequest(t, ts, http.MethodPut, "/admin/maintenance", adminKey, `{"read_only":true}`)
+	resp.Body.Close()
+	if !s.ReadOnly() {
+		t.Fatalf("Expected maintenance mode to be on")
+	}
+	sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": "lobby", "content": "hello?"})
+	if frame := readFrame(t, alice); frame["type"] != "error" {
+		t.Errorf("Expected messages to be refused in maintenance mode, got %v", frame)
+	}
+	resp, _ = http.Post(ts.URL+"/room/fresh", "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected room creation to be refused in maintenance mode, got %s", resp.Status)
+	}
+
+	// Every way of writing over a connection is refused, and only alice
+	// hears about it.
+	refused := func(desc string, frame map[string]interface{}) {
+		t.Helper()
+		sendFrame(t, alice, frame)
+		reply := readFrame(t, alice)
+		data, _ := reply["data"].(map[string]interface{})
+		text, _ := data["reason"].(string)
+		if reply["type"] == "system" {
+			text, _ = data["content"].(string)
+		}
+		if !strings.Contains(text, "read-only") {
+			t.Errorf("Expected %s to be refused in maintenance mode, got %v", desc, reply)
+		}
+	}
+	refused("joining a new room", map[string]interface{}{"type": "join", "room": "fresh"})
+	refused("setting the topic", map[string]interface{}{"type": "set_topic", "room": "lobby", "topic": "closed"})
+	refused("a direct message", map[string]interface{}{"type": "direct", "to": connections[1].User, "content": "psst"})
+	refused("/me", map[string]interface{}{"type": "chat", "room": "lobby", "content": "/me waves"})
+	refused("/topic", map[string]interface{}{"type": "chat", "room": "lobby", "content": "/topic closed"})
+	refused("/kick", map[string]interface{}{"type": "chat", "room": "lobby", "content": "/kick " + connections[1].User})
+
+	resp = adminRequest(t, ts, http.MethodPut, "/admin/maintenance", adminKey, `{"read_only":false}`)
+	resp.Body.Close()
+	sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": "lobby", "content": "back"})
+	if frame := readFrame(t, bob); frame["content"] != "back" {
+		t.Errorf("Expected messages to flow after maintenance, got %v", frame)
+	}
+
+	bobID := connections[1].ID
+	resp = adminRequest(t, ts, http.MethodDelete, "/admin/connections/"+bobID, adminKey, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204 from disconnect, got %s", resp.Status)
+	}
+	waitFor(t, "the connection to close", func() bool {
+		return len(adminConnections(t, ts, "/admin/connections")) == 1
+	})
+	bob.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := bob.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	resp = adminRequest(t, ts, http.MethodDelete, "/admin/connections/"+bobID, adminKey, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a closed connection, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,148 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chat/internal/backplane"
+	"chat/internal/config"
+	"chat/internal/server"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// testCrossNodeChat connects one client to each node and checks that they
+// share the lobby. subscribers reports how many nodes listen to a room.
+func testCrossNodeChat(t *testing.T, bpA, bpB backplane.Backplane, subscribers func(room string) int) {
+	cfg := &config.Config{Address: ":8080"}
+	nodeA := httptest.NewServer(server.NewServer(cfg, server.WithBackplane(bpA)).Router())
+	defer nodeA.Close()
+	nodeB := httptest.NewServer(server.NewServer(cfg, server.WithBackplane(bpB)).Router())
+	defer nodeB.Close()
+
+	resp, err := http.Post(nodeA.URL+"/room/empty", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	resp.Body.Close()
+
+	alice := dialWebSocket(t, nodeA)
+	bob := dialWebSocket(t, nodeB)
+	joinAndWait(t, nodeA, alice, "lobby", 1)
+	joinAndWait(t, nodeB, bob, "lobby", 1)
+	waitFor(t, "both nodes to subscribe", func() bool { return subscribers("lobby") == 2 })
+	if n := subscribers("empty"); n != 0 {
+		t.Errorf("Expected no subscription for a room without members, got %d", n)
+	}
+
+	sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": "lobby", "content": "from a"})
+	if frame := readFrame(t, bob); frame["content"] != "from a" {
+		t.Errorf("Unexpected frame on node B: %v", frame)
+	}
+	if frame := readFrame(t, alice); frame["content"] != "from a" {
+		t.Errorf("Unexpected echo on node A: %v", frame)
+	}
+
+	sendFrame(t, bob, map[string]interface{}{"type": "chat", "room": "lobby", "content": "from b"})
+	if frame := readFrame(t, alice); frame["content"] != "from b" {
+		t.Errorf("Expected node A to see node B's message exactly once after its own, got %v", frame)
+	}
+	if frame := readFrame(t, bob); frame["content"] != "from b" {
+		t.Errorf("Unexpected echo on node B: %v", frame)
+	}
+
+	sendFrame(t, bob, map[string]interface{}{"type": "leave", "room": "lobby"})
+	waitFor(t, "node B to unsubscribe", func() bool { return subscribers("lobby") == 1 })
+}
+
+func TestMemoryBackplane(t *testing.T) {
+	bp := backplane.NewMemory()
+	testCrossNodeChat(t, bp, bp, bp.Subscribers)
+}
+
+func TestRedisBackplane(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	newBackplane := func() backplane.Backplane {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		bp := backplane.NewRedis(client, "")
+		t.Cleanup(func() { bp.Close() })
+		return bp
+	}
+
+	testCrossNodeChat(t, newBackplane(), newBackplane(), func(room string) int {
+		channel := backplane.DefaultRedisPrefix + room
+		return mr.PubSubNumSub(channel)[channel]
+	})
+}
+
+// stallingBackplane holds up the room that subscribes to stalled, as a room
+// whose Run loop is busy would be, until release is closed.
+type stallingBackplane struct {
+	*backplane.Memory
+	stalled string
+	release chan struct{}
+}
+
+func (b *stallingBackplane) Subscribe(room string, handler backplane.Handler) (func(), error) {
+	unsubscribe, err := b.Memory.Subscribe(room, handler)
+	if room == b.stalled {
+		<-b.release
+	}
+	return unsubscribe, err
+}
+
+func TestBackplaneSlowRoom(t *testing.T) {
+	bp := &stallingBackplane{Memory: backplane.NewMemory(), stalled: "slow", release: make(chan struct{})}
+	defer close(bp.release)
+	s := server.NewServer(&config.Config{Address: ":8080"}, server.WithBackplane(bp))
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	alice := dialWebSocket(t, ts)
+	joinAndWait(t, ts, alice, "lobby", 1)
+	sendFrame(t, alice, map[string]interface{}{"type": "join", "room": "slow"})
+	waitFor(t, "both rooms to subscribe", func() bool { return bp.Subscribers("slow") == 1 && bp.Subscribers("lobby") == 1 })
+	before := scrapeMetrics(t, ts)
+
+	// Frames from another node keep arriving for the stalled room; they
+	// must not hold up the lobby's.
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < 1000; i++ {
+			bp.Publish(context.Background(), "slow", []byte(`{"node":"b","frame":{"type":"chat","room":"slow","content":"backlog"}}`))
+		}
+		bp.Publish(context.Background(), "lobby", []byte(`{"node":"b","frame":{"type":"chat","room":"lobby","content":"from b"}}`))
+	}()
+	select {
+	case <-published:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out publishing: a stalled room held up the backplane")
+	}
+	if frame := readFrame(t, alice); frame["content"] != "from b" {
+		t.Errorf("Expected the lobby's frame, got %v", frame)
+	}
+
+	after := scrapeMetrics(t, ts)
+	if dropped := after["chat_backplane_drops_total"] - before["chat_backplane_drops_total"]; dropped < 1000-256 {
+		t.Errorf("Expected the stalled room's overflow to be dropped and counted, got %v", dropped)
+	}
+}
@@ -0,0 +1,114 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/internal/chat"
+	"chat/internal/config"
+	"chat/internal/server"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBatchedFrames(t *testing.T) {
+	cfg := &config.Config{
+		Address:          ":8080",
+		BatchMaxMessages: 16,
+		BatchMaxDelay:    200 * time.Millisecond,
+	}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/ws?batch=xml")
+	if err != nil {
+		t.Fatalf("Failed to request websocket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown batch mode, got %d", resp.StatusCode)
+	}
+
+	for _, mode := range []string{chat.BatchLines, chat.BatchEnvelope} {
+		t.Run(mode, func(t *testing.T) {
+			room := "burst-" + mode
+			url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?batch=" + mode
+			var members []*websocket.Conn
+			for i := 0; i < 2; i++ {
+				batched, _, err := websocket.DefaultDialer.Dial(url, nil)
+				if err != nil {
+					t.Fatalf("Failed to dial websocket: %v", err)
+				}
+				defer batched.Close()
+				joinAndWait(t, ts, batched, room, i+1)
+				members = append(members, batched)
+			}
+
+			sender := dialWebSocket(t, ts)
+			joinAndWait(t, ts, sender, room, 3)
+			for _, content := range []string{"one", "two", "three"} {
+				sendFrame(t, sender, map[string]interface{}{"type": "chat", "room": room, "content": content})
+			}
+
+			// Both members drain the same broadcasts, so they share the
+			// prepared batches and must each still see every chat in order.
+			for _, batched := range members {
+				var chats []string
+				largest := 0
+				for len(chats) < 3 {
+					batched.SetReadDeadline(time.Now().Add(2 * time.Second))
+					_, message, err := batched.ReadMessage()
+					if err != nil {
+						t.Fatalf("Failed to read message: %v", err)
+					}
+
+					var frames []json.RawMessage
+					if mode == chat.BatchLines {
+						for _, line := range bytes.Split(message, []byte("\n")) {
+							frames = append(frames, line)
+						}
+					} else {
+						var envelope struct {
+							Type   string            `json:"type"`
+							Frames []json.RawMessage `json:"frames"`
+						}
+						if err := json.Unmarshal(message, &envelope); err != nil {
+							t.Fatalf("Invalid message %s: %v", message, err)
+						}
+						frames = []json.RawMessage{message}
+						if envelope.Type == chat.EventBatch {
+							frames = envelope.Frames
+						}
+					}
+					if len(frames) > largest {
+						largest = len(frames)
+					}
+
+					for _, raw := range frames {
+						var frame map[string]interface{}
+						if err := json.Unmarshal(raw, &frame); err != nil {
+							t.Fatalf("Invalid frame %s: %v", raw, err)
+						}
+						if frame["type"] == "chat" {
+							chats = append(chats, frame["content"].(string))
+						}
+					}
+				}
+
+				if strings.Join(chats, ",") != "one,two,three" {
+					t.Errorf("Unexpected chat order: %v", chats)
+				}
+				if largest < 2 {
+					t.Errorf("Expected queued frames to be coalesced into one message")
+				}
+			}
+		})
+	}
+}
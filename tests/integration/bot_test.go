@@ -0,0 +1,207 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"chat/internal/bot"
+	"chat/internal/chat"
+	"chat/internal/config"
+	"chat/internal/server"
+)
+
+func TestEchoBot(t *testing.T) {
+	cfg := &config.Config{Address: ":8080"}
+	s := server.NewServer(cfg, server.WithBots(bot.NewEcho("echo", "bots")))
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/room/bots/members")
+	if err != nil {
+		t.Fatalf("Failed to list members: %v", err)
+	}
+	var members []chat.MemberInfo
+	json.NewDecoder(resp.Body).Decode(&members)
+	resp.Body.Close()
+	if len(members) != 1 || members[0].Name != "echo" || !members[0].Bot {
+		t.Fatalf("Expected echo bot member, got %v", members)
+	}
+
+	conn := dialWebSocket(t, ts)
+	joinAndWait(t, ts, conn, "bots", 2)
+	if frame := readAnyFrame(t, conn); frame["type"] != chat.EventJoin {
+		t.Fatalf("Expected join event, got %v", frame)
+	}
+
+	sendFrame(t, conn, map[string]interface{}{"type": "chat", "room": "bots", "content": "@echo hello"})
+	readFrame(t, conn)
+	frame := readFrame(t, conn)
+	if frame["sender"] != "echo" || frame["content"] != "guest-1: hello" {
+		t.Errorf("Expected echoed message, got %v", frame)
+	}
+}
+
+// stallingBot blocks on its first event until released, and reports the
+// content of every message it handles after that.
+type stallingBot struct {
+	release chan struct{}
+	once    sync.Once
+	handled chan string
+}
+
+func (b *stallingBot) Name() string { return "staller" }
+
+func (b *stallingBot) Init(api bot.API) error { return api.Join("busy") }
+
+func (b *stallingBot) Handle(ctx context.Context, ev bot.Event) error {
+	b.once.Do(func() { <-b.release })
+	if ev.Message != nil {
+		b.handled <- ev.Message.Content
+	}
+	return nil
+}
+
+func TestBotReattachedAfterFallingBehind(t *testing.T) {
+	staller := &stallingBot{release: make(chan struct{}), handled: make(chan string, 16)}
+	s := server.NewServer(&config.Config{Address: ":8080"}, server.WithBots(staller))
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	// More events than the bot's queue holds arrive while it is stuck, so
+	// the fan-out drops it.
+	for i := 0; i < 300; i++ {
+		s.Announce("filler")
+	}
+	close(staller.release)
+
+	conn := dialWebSocket(t, ts)
+	joinAndWait(t, ts, conn, "busy", 2)
+	sendFrame(t, conn, map[string]interface{}{"type": "chat", "room": "busy", "content": "still listening?"})
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case content := <-staller.handled:
+			if content != "still listening?" {
+				continue
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for the bot to handle a message after being dropped")
+		}
+		break
+	}
+
+	resp, err := http.Get(ts.URL + "/room/busy/members")
+	if err != nil {
+		t.Fatalf("Failed to list members: %v", err)
+	}
+	var members []chat.MemberInfo
+	json.NewDecoder(resp.Body).Decode(&members)
+	resp.Body.Close()
+	if len(members) != 2 || members[0].Name != "guest-1" || members[1].Name != "staller" {
+		t.Errorf("Expected the bot to be a member once, got %v", members)
+	}
+}
+
+// keeperBot joins a room and keeps its API for the test to drive.
+type keeperBot struct {
+	api bot.API
+}
+
+func (b *keeperBot) Name() string { return "keeper" }
+
+func (b *keeperBot) Init(api bot.API) error {
+	b.api = api
+	return api.Join("ops")
+}
+
+func (b *keeperBot) Handle(ctx context.Context, ev bot.Event) error { return nil }
+
+func TestBotWritesRefusedInMaintenance(t *testing.T) {
+	keeper := &keeperBot{}
+	s := server.NewServer(&config.Config{Address: ":8080"}, server.WithBots(keeper))
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	conn := dialWebSocket(t, ts)
+	joinAndWait(t, ts, conn, "ops", 2)
+
+	s.SetReadOnly(true)
+	if err := keeper.api.React("ops", "m1", "+1"); !errors.Is(err, server.ErrReadOnly) {
+		t.Errorf("Expected a reaction to be refused, got %v", err)
+	}
+	if err := keeper.api.Kick("ops", "guest-1", "spam"); !errors.Is(err, server.ErrReadOnly) {
+		t.Errorf("Expected a kick to be refused, got %v", err)
+	}
+	if members, _ := s.RoomConnections("ops"); len(members) != 2 {
+		t.Errorf("Expected nobody to be kicked, got %v", members)
+	}
+}
+
+func TestAdminDisconnectStopsBot(t *testing.T) {
+	keeper := &keeperBot{}
+	s := server.NewServer(&config.Config{Address: ":8080", AdminKeys: []string{adminKey}}, server.WithBots(keeper))
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	conn := dialWebSocket(t, ts)
+	joinAndWait(t, ts, conn, "ops", 2)
+
+	var botID string
+	for _, c := range adminConnections(t, ts, "/admin/connections") {
+		if c.Bot {
+			botID = c.ID
+		}
+	}
+	resp := adminRequest(t, ts, http.MethodDelete, "/admin/connections/"+botID, adminKey, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected the bot to be disconnected, got %v", resp.Status)
+	}
+
+	waitFor(t, "the bot to leave", func() bool {
+		return len(adminConnections(t, ts, "/admin/connections")) == 1
+	})
+	time.Sleep(50 * time.Millisecond)
+	if connections := adminConnections(t, ts, "/admin/connections"); len(connections) != 1 || connections[0].Bot {
+		t.Errorf("Expected the bot to stay gone, got %+v", connections)
+	}
+	if err := keeper.api.Join("ops"); err == nil {
+		t.Errorf("Expected a stopped bot to be unable to rejoin")
+	}
+}
+
+func TestBotNamesAreClaimed(t *testing.T) {
+	s := server.NewServer(&config.Config{Address: ":8080"}, server.WithBots(
+		bot.NewEcho("echo", "bots"),
+		bot.NewEcho("echo", "bots"),
+		bot.NewEcho("bad name", "bots"),
+	))
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	members, err := s.RoomConnections("bots")
+	if err != nil {
+		t.Fatalf("Failed to list members: %v", err)
+	}
+	if len(members) != 1 || members[0].User != "echo" {
+		t.Errorf("Expected a single echo bot, got %+v", members)
+	}
+
+	// Nobody can take the bot's name either.
+	conn := dialWebSocket(t, ts)
+	joinAndWait(t, ts, conn, "bots", 2)
+	sendFrame(t, conn, map[string]interface{}{"type": "chat", "room": "bots", "content": "/nick echo"})
+	if frame := readFrame(t, conn); !strings.Contains(fmt.Sprint(frame["data"]), "already in use") {
+		t.Errorf("Expected the nick to be refused, got %v", frame)
+	}
+}
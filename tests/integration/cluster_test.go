@@ -0,0 +1,341 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chat/internal/backplane"
+	"chat/internal/cluster"
+	"chat/internal/config"
+	"chat/internal/server"
+)
+
+func TestClusterRoomOwnership(t *testing.T) {
+	bp := backplane.NewMemory()
+
+	ids := []string{"a", "b", "c"}
+	listeners := make(map[string]*httptest.Server)
+	var peers []cluster.Peer
+	for _, id := range ids {
+		ts := httptest.NewUnstartedServer(nil)
+		listeners[id] = ts
+		peers = append(peers, cluster.Peer{ID: id, URL: "http://" + ts.Listener.Addr().String()})
+	}
+
+	servers := make(map[string]*server.Server)
+	nodes := make(map[string]*cluster.Cluster)
+	for _, id := range ids {
+		c, err := cluster.New(cluster.Options{
+			Self:      id,
+			Peers:     peers,
+			Secret:    "s3cret",
+			Heartbeat: 50 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create cluster node %s: %v", id, err)
+		}
+		nodes[id] = c
+		cfg := &config.Config{Address: ":8080"}
+		servers[id] = server.NewServer(cfg, server.WithBackplane(bp), server.WithCluster(c))
+		listeners[id].Config.Handler = servers[id].Router()
+		listeners[id].Start()
+		defer listeners[id].Close()
+	}
+
+	ring := cluster.NewRing(0)
+	for _, id := range ids {
+		ring.Add(id)
+	}
+	var room string
+	for i := 0; room == ""; i++ {
+		if candidate := fmt.Sprintf("room-%d", i); ring.Owner(candidate) == "c" {
+			room = candidate
+		}
+	}
+
+	alice := dialWebSocket(t, listeners["a"])
+	bob := dialWebSocket(t, listeners["b"])
+	joinAndWait(t, listeners["a"], alice, room, 1)
+	joinAndWait(t, listeners["b"], bob, room, 1)
+	waitFor(t, "both nodes to subscribe", func() bool { return bp.Subscribers(room) == 2 })
+
+	sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": room, "content": "one"})
+	if frame := readFrame(t, bob); frame["content"] != "one" || frame["seq"] != float64(1) {
+		t.Errorf("Unexpected frame on node b: %v", frame)
+	}
+	readFrame(t, alice)
+
+	sendFrame(t, bob, map[string]interface{}{"type": "chat", "room": room, "content": "two"})
+	if frame := readFrame(t, alice); frame["content"] != "two" || frame["seq"] != float64(2) {
+		t.Errorf("Unexpected frame on node a: %v", frame)
+	}
+	readFrame(t, bob)
+
+	history, err := servers["a"].History(context.Background(), room, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to read history through node a: %v", err)
+	}
+	if len(history) != 2 || history[0].Content != "one" || history[1].Content != "two" {
+		t.Errorf("Expected the owner's history, got %+v", history)
+	}
+
+	// Taking the owner down moves the room to a surviving node, which carries
+	// on numbering from the last message it saw.
+	listeners["c"].Close()
+	waitFor(t, "node c to leave the ring", func() bool {
+		return len(nodes["a"].Members()) == 2 && len(nodes["b"].Members()) == 2
+	})
+
+	sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": room, "content": "three"})
+	if frame := readFrame(t, bob); frame["content"] != "three" || frame["seq"] != float64(3) {
+		t.Errorf("Unexpected frame after failover: %v", frame)
+	}
+}
+
+func TestClusterRequiresSecret(t *testing.T) {
+	peers := []cluster.Peer{{ID: "a", URL: "http://a"}}
+	if _, err := cluster.New(cluster.Options{Self: "a", Peers: peers}); !errors.Is(err, cluster.ErrNoSecret) {
+		t.Fatalf("Expected ErrNoSecret, got %v", err)
+	}
+
+	c, err := cluster.New(cluster.Options{Self: "a", Peers: peers, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Failed to create cluster node: %v", err)
+	}
+	s := server.NewServer(&config.Config{Address: ":8080"}, server.WithCluster(c))
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	for _, secret := range []string{"", "wrong"} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cluster/rooms/lobby/messages",
+			strings.NewReader(`{"sender":"admin","content":"forged"}`))
+		if secret != "" {
+			req.Header.Set(cluster.SecretHeader, secret)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to post cluster message: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected secret %q to be refused, got %v", secret, resp.Status)
+		}
+	}
+}
+
+// clusterNode is a cluster member whose network can be cut off, both for the
+// requests it serves and for those it sends. A node with stalled replicas
+// still answers heartbeats but never answers replication.
+type clusterNode struct {
+	server      *server.Server
+	cluster     *cluster.Cluster
+	listener    *httptest.Server
+	partitioned atomic.Bool
+	stalled     atomic.Bool
+}
+
+func (n *clusterNode) RoundTrip(req *http.Request) (*http.Response, error) {
+	if n.partitioned.Load() {
+		return nil, errors.New("partitioned")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func startClusterNodes(t *testing.T, bp backplane.Backplane, ids ...string) map[string]*clusterNode {
+	t.Helper()
+
+	nodes := make(map[string]*clusterNode)
+	var peers []cluster.Peer
+	for _, id := range ids {
+		node := &clusterNode{}
+		node.listener = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if node.partitioned.Load() {
+				http.Error(w, "Partitioned", http.StatusServiceUnavailable)
+				return
+			}
+			if node.stalled.Load() && r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/replica") {
+				io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+				return
+			}
+			node.server.Router().ServeHTTP(w, r)
+		}))
+		nodes[id] = node
+		peers = append(peers, cluster.Peer{ID: id, URL: "http://" + node.listener.Listener.Addr().String()})
+	}
+
+	for _, id := range ids {
+		node := nodes[id]
+		c, err := cluster.New(cluster.Options{
+			Self:      id,
+			Peers:     peers,
+			Secret:    "s3cret",
+			Heartbeat: 50 * time.Millisecond,
+			Client:    &http.Client{Transport: node, Timeout: time.Second},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create cluster node %s: %v", id, err)
+		}
+		node.cluster = c
+		node.server = server.NewServer(&config.Config{Address: ":8080"}, server.WithBackplane(bp), server.WithCluster(c))
+		node.listener.Start()
+		t.Cleanup(node.listener.Close)
+	}
+	return nodes
+}
+
+func TestClusterFailoverHandoff(t *testing.T) {
+	bp := backplane.NewMemory()
+	nodes := startClusterNodes(t, bp, "a", "b", "c")
+
+	// Pick a room owned by c that moves to b, which has no members of it,
+	// when c leaves.
+	ring := cluster.NewRing(0)
+	for _, id := range []string{"a", "b", "c"} {
+		ring.Add(id)
+	}
+	var room string
+	for i := 0; room == ""; i++ {
+		candidate := fmt.Sprintf("room-%d", i)
+		if ring.Owner(candidate) == "c" && ring.OwnerExcept(candidate, "c") == "b" {
+			room = candidate
+		}
+	}
+
+	alice := dialWebSocket(t, nodes["a"].listener)
+	joinAndWait(t, nodes["a"].listener, alice, room, 1)
+	waitFor(t, "node a to subscribe", func() bool { return bp.Subscribers(room) == 1 })
+
+	send := func(content string, seq uint64) {
+		t.Helper()
+		sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": room, "content": content})
+		if frame := readFrame(t, alice); frame["content"] != content || frame["seq"] != float64(seq) {
+			t.Fatalf("Expected %q with seq %d, got %v", content, seq, frame)
+		}
+	}
+	history := func() []string {
+		t.Helper()
+		messages, err := nodes["a"].server.History(context.Background(), room, 0, 0)
+		if err != nil {
+			t.Fatalf("Failed to read history: %v", err)
+		}
+		var contents []string
+		for _, msg := range messages {
+			contents = append(contents, fmt.Sprintf("%d:%s", msg.Seq, msg.Content))
+		}
+		return contents
+	}
+	members := func(want int) func() bool {
+		return func() bool {
+			for _, node := range nodes {
+				if !node.partitioned.Load() && len(node.cluster.Members()) != want {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	send("one", 1)
+	send("two", 2)
+	waitFor(t, "node b to hold the replica", func() bool {
+		messages, err := nodes["a"].cluster.Replica(context.Background(), nodes["b"].cluster.Self(), room, 0)
+		return err == nil && len(messages) == 2
+	})
+
+	// c is cut off: b takes the room over without ever having had members
+	// in it, carrying on from the replica c kept on it.
+	nodes["c"].partitioned.Store(true)
+	waitFor(t, "node c to leave the ring", members(2))
+	waitFor(t, "node c to lose its peers", func() bool { return len(nodes["c"].cluster.Members()) == 1 })
+
+	send("three", 3)
+	if got := strings.Join(history(), ","); got != "1:one,2:two,3:three" {
+		t.Errorf("Unexpected history after failover: %s", got)
+	}
+
+	// c comes back still holding its stale state, and catches up before
+	// numbering the room's messages again.
+	nodes["c"].partitioned.Store(false)
+	waitFor(t, "node c to rejoin the ring", members(3))
+
+	send("four", 4)
+	if got := strings.Join(history(), ","); got != "1:one,2:two,3:three,4:four" {
+		t.Errorf("Unexpected history after rejoining: %s", got)
+	}
+}
+
+func TestClusterStalledReplicaDoesNotBlockPublish(t *testing.T) {
+	bp := backplane.NewMemory()
+	nodes := startClusterNodes(t, bp, "a", "b")
+
+	ring := cluster.NewRing(0)
+	ring.Add("a")
+	ring.Add("b")
+	var room string
+	for i := 0; room == ""; i++ {
+		if candidate := fmt.Sprintf("room-%d", i); ring.Owner(candidate) == "a" {
+			room = candidate
+		}
+	}
+
+	alice := dialWebSocket(t, nodes["a"].listener)
+	joinAndWait(t, nodes["a"].listener, alice, room, 1)
+
+	// b keeps answering heartbeats, so a still replicates to it, but each
+	// replication request hangs until the client gives up.
+	nodes["b"].stalled.Store(true)
+	start := time.Now()
+	for i := 1; i <= 3; i++ {
+		content := fmt.Sprintf("message %d", i)
+		sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": room, "content": content})
+		if frame := readFrame(t, alice); frame["content"] != content {
+			t.Fatalf("Expected %q, got %v", content, frame)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected publishes not to wait for a stalled successor, took %v", elapsed)
+	}
+
+	nodes["b"].stalled.Store(false)
+	waitFor(t, "node b to catch up on the replica", func() bool {
+		sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": room, "content": "ping"})
+		readFrame(t, alice)
+		messages, err := nodes["a"].cluster.Replica(context.Background(), nodes["b"].cluster.Self(), room, 0)
+		return err == nil && len(messages) > 0 && messages[len(messages)-1].Content == "ping"
+	})
+}
+
+func TestClusterMessageReadOnly(t *testing.T) {
+	c, err := cluster.New(cluster.Options{Self: "a", Peers: []cluster.Peer{{ID: "a", URL: "http://a"}}, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Failed to create cluster node: %v", err)
+	}
+	s := server.NewServer(&config.Config{Address: ":8080"}, server.WithCluster(c))
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	s.SetReadOnly(true)
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/cluster/rooms/lobby/messages",
+		strings.NewReader(`{"sender":"bob","content":"forwarded"}`))
+	req.Header.Set(cluster.SecretHeader, "s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to post cluster message: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected forwarded messages to be refused in maintenance mode, got %v", resp.Status)
+	}
+	if _, err := s.GetRoom("lobby"); err == nil {
+		t.Error("Expected no room to be opened in maintenance mode")
+	}
+}
@@ -0,0 +1,87 @@
+package integration
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/internal/chat"
+	"chat/internal/config"
+	"chat/internal/server"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestMsgpackCodec(t *testing.T) {
+	cfg := &config.Config{Address: ":8080"}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"chat.v2.cbor", chat.ProtocolMsgpack, chat.ProtocolJSON}}
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+	packed, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial websocket: %v", err)
+	}
+	defer packed.Close()
+	if packed.Subprotocol() != chat.ProtocolMsgpack {
+		t.Fatalf("Expected %s to be negotiated, got %q", chat.ProtocolMsgpack, packed.Subprotocol())
+	}
+
+	writePacked := func(frame map[string]interface{}) {
+		t.Helper()
+		payload, err := msgpack.Marshal(frame)
+		if err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+		if err := packed.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+			t.Fatalf("Failed to write frame: %v", err)
+		}
+	}
+	readPacked := func() map[string]interface{} {
+		t.Helper()
+		for {
+			packed.SetReadDeadline(time.Now().Add(2 * time.Second))
+			messageType, payload, err := packed.ReadMessage()
+			if err != nil {
+				t.Fatalf("Failed to read frame: %v", err)
+			}
+			if messageType != websocket.BinaryMessage {
+				t.Fatalf("Expected a binary message, got type %d", messageType)
+			}
+			var frame map[string]interface{}
+			if err := msgpack.Unmarshal(payload, &frame); err != nil {
+				t.Fatalf("Failed to decode frame: %v", err)
+			}
+			if frame["type"] != chat.EventJoin && frame["type"] != chat.EventLeave {
+				return frame
+			}
+		}
+	}
+
+	writePacked(map[string]interface{}{"type": "join", "room": "lobby"})
+	plain := dialWebSocket(t, ts)
+	joinAndWait(t, ts, plain, "lobby", 2)
+
+	sendFrame(t, plain, map[string]interface{}{"type": "chat", "room": "lobby", "content": "from json"})
+	frame := readPacked()
+	if frame["content"] != "from json" || frame["sender"] != "guest-2" {
+		t.Errorf("Unexpected msgpack frame: %v", frame)
+	}
+	if seq, ok := frame["seq"].(int64); !ok || seq != 1 {
+		t.Errorf("Expected seq to arrive as an integer, got %T %v", frame["seq"], frame["seq"])
+	}
+	readFrame(t, plain)
+
+	writePacked(map[string]interface{}{"type": "chat", "room": "lobby", "content": "from msgpack"})
+	if frame := readFrame(t, plain); frame["content"] != "from msgpack" || frame["sender"] != "guest-1" {
+		t.Errorf("Unexpected json frame: %v", frame)
+	}
+	if frame := readPacked(); frame["content"] != "from msgpack" {
+		t.Errorf("Unexpected msgpack echo: %v", frame)
+	}
+}
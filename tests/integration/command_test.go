@@ -0,0 +1,186 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/internal/command"
+	"chat/internal/config"
+	"chat/internal/server"
+	"chat/internal/webhook"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSlashCommands(t *testing.T) {
+	ping := command.Command{
+		Name:        "ping",
+		Description: "Reply with pong",
+		Handler: func(ctx *command.Context) error {
+			ctx.Reply("pong")
+			return nil
+		},
+	}
+
+	cfg := &config.Config{Address: ":8080"}
+	s := server.NewServer(cfg, server.WithCommands(ping))
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	alice := dialWebSocket(t, ts)
+	bob := dialWebSocket(t, ts)
+	joinAndWait(t, ts, alice, "cmds", 1)
+	joinAndWait(t, ts, bob, "cmds", 2)
+
+	run := func(content string) {
+		sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": "cmds", "content": content})
+	}
+	systemText := func(frame map[string]interface{}) string {
+		if frame["type"] != command.EventSystem {
+			t.Fatalf("Expected system frame, got %v", frame)
+		}
+		return frame["data"].(map[string]interface{})["content"].(string)
+	}
+
+	run("/ping")
+	if text := systemText(readFrame(t, alice)); text != "pong" {
+		t.Errorf("Expected pong, got %q", text)
+	}
+
+	run("/nick alice extra")
+	if text := systemText(readFrame(t, alice)); !strings.HasPrefix(text, "usage: /nick") {
+		t.Errorf("Expected usage error, got %q", text)
+	}
+
+	run("/nick alice")
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		if frame := readFrame(t, conn); frame["type"] != "nick" {
+			t.Errorf("Expected nick event, got %v", frame)
+		}
+	}
+
+	run("/help")
+	if text := systemText(readFrame(t, alice)); !strings.Contains(text, "/ping - Reply with pong") {
+		t.Errorf("Expected generated help, got %q", text)
+	}
+
+	run("//not a command")
+	if frame := readFrame(t, bob); frame["content"] != "/not a command" || frame["sender"] != "alice" {
+		t.Errorf("Expected escaped chat message, got %v", frame)
+	}
+}
+
+func TestKickRequiresRoomOwner(t *testing.T) {
+	s := server.NewServer(&config.Config{Address: ":8080"})
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	systemText := func(conn *websocket.Conn) string {
+		t.Helper()
+		frame := readFrame(t, conn)
+		if frame["type"] != command.EventSystem {
+			t.Fatalf("Expected system frame, got %v", frame)
+		}
+		return frame["data"].(map[string]interface{})["content"].(string)
+	}
+
+	// Claiming to have created the room does not make a member its owner;
+	// the first member to join it is.
+	resp, err := http.Post(ts.URL+"/room/claimed", "application/json", strings.NewReader(`{"created_by":"mallory"}`))
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	resp.Body.Close()
+
+	alice := dialWebSocket(t, ts)
+	mallory := dialWebSocket(t, ts)
+	joinAndWait(t, ts, alice, "claimed", 1)
+	joinAndWait(t, ts, mallory, "claimed", 2)
+	sendFrame(t, mallory, map[string]interface{}{"type": "chat", "room": "claimed", "content": "/nick mallory"})
+	readFrame(t, alice)
+	readFrame(t, mallory)
+
+	sendFrame(t, mallory, map[string]interface{}{"type": "chat", "room": "claimed", "content": "/kick guest-1"})
+	if text := systemText(mallory); !strings.Contains(text, "only the room's owner") {
+		t.Errorf("Expected the kick to be refused, got %q", text)
+	}
+
+	// The member who opened the room may kick, the others may not.
+	joinAndWait(t, ts, alice, "owned", 1)
+	joinAndWait(t, ts, mallory, "owned", 2)
+
+	sendFrame(t, mallory, map[string]interface{}{"type": "chat", "room": "owned", "content": "/kick guest-1"})
+	if text := systemText(mallory); !strings.Contains(text, "only the room's owner") {
+		t.Errorf("Expected the kick to be refused, got %q", text)
+	}
+
+	sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": "owned", "content": "/kick mallory spam"})
+	if frame := readFrame(t, mallory); frame["type"] != "kicked" {
+		t.Errorf("Expected mallory to be kicked, got %v", frame)
+	}
+}
+
+func TestActionsAndKicksInOpenedRooms(t *testing.T) {
+	received := make(chan webhook.Event, 16)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev webhook.Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		received <- ev
+	}))
+	defer receiver.Close()
+
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"ci-key"}}
+	s := server.NewServer(cfg)
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	// The room is opened over HTTP, so no member opened it.
+	resp := adminRequest(t, ts, http.MethodPost, "/room/opened", "", "")
+	resp.Body.Close()
+	resp = adminRequest(t, ts, http.MethodPost, "/room/opened/webhooks", "ci-key", `{"url":"`+receiver.URL+`","events":["message","leave"]}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected the webhook to be registered, got %v", resp.Status)
+	}
+	next := func(eventType string) webhook.Event {
+		t.Helper()
+		select {
+		case ev := <-received:
+			if ev.Type != eventType || ev.Room != "opened" {
+				t.Fatalf("Expected a %s webhook for opened, got %+v", eventType, ev)
+			}
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for a %s webhook", eventType)
+		}
+		return webhook.Event{}
+	}
+
+	alice := dialWebSocket(t, ts)
+	bob := dialWebSocket(t, ts)
+	joinAndWait(t, ts, alice, "opened", 1)
+	joinAndWait(t, ts, bob, "opened", 2)
+	sendFrame(t, bob, map[string]interface{}{"type": "chat", "room": "opened", "content": "/nick bob"})
+	readFrame(t, alice)
+	readFrame(t, bob)
+
+	// Actions are stored and delivered like any other message.
+	sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": "opened", "content": "/me waves"})
+	frame := readFrame(t, bob)
+	if frame["type"] != "action" || frame["content"] != "waves" || frame["seq"] == nil || frame["id"] == nil {
+		t.Errorf("Expected a stored action, got %v", frame)
+	}
+	next(webhook.EventMessage)
+
+	// The first member to join may kick, and a kick is a leave.
+	sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": "opened", "content": "/kick bob flooding"})
+	if frame := readFrame(t, bob); frame["type"] != "kicked" {
+		t.Errorf("Expected bob to be kicked, got %v", frame)
+	}
+	next(webhook.EventLeave)
+}
@@ -0,0 +1,83 @@
+package integration
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/internal/chat"
+	"chat/internal/config"
+	"chat/internal/server"
+
+	"github.com/gorilla/websocket"
+)
+
+func compressionStats(t *testing.T, ts *httptest.Server) chat.CompressionSnapshot {
+	t.Helper()
+
+	samples := scrapeMetrics(t, ts)
+	return chat.CompressionSnapshot{
+		Messages:     uint64(samples["chat_ws_compressed_messages_total"]),
+		Skipped:      uint64(samples["chat_ws_uncompressed_messages_total"]),
+		PayloadBytes: uint64(samples["chat_ws_compressed_payload_bytes_total"]),
+		WireBytes:    uint64(samples["chat_ws_compressed_wire_bytes_total"]),
+	}
+}
+
+func TestCompression(t *testing.T) {
+	cfg := &config.Config{
+		Address:              ":8080",
+		Compression:          true,
+		CompressionThreshold: 256,
+		CompressionLevel:     9,
+	}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+	compressed, resp, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial websocket: %v", err)
+	}
+	defer compressed.Close()
+	if !strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+		t.Fatalf("Expected permessage-deflate to be negotiated, got %q", resp.Header.Get("Sec-WebSocket-Extensions"))
+	}
+
+	plain := dialWebSocket(t, ts)
+	joinAndWait(t, ts, compressed, "lobby", 1)
+	joinAndWait(t, ts, plain, "lobby", 2)
+
+	before := compressionStats(t, ts)
+
+	sendFrame(t, plain, map[string]interface{}{"type": "chat", "room": "lobby", "content": "hi"})
+	if frame := readFrame(t, compressed); frame["content"] != "hi" {
+		t.Errorf("Unexpected frame: %v", frame)
+	}
+	readFrame(t, plain)
+
+	long := strings.Repeat("all work and no play makes jack a dull boy ", 50)
+	sendFrame(t, plain, map[string]interface{}{"type": "chat", "room": "lobby", "content": long})
+	if frame := readFrame(t, compressed); frame["content"] != long {
+		t.Errorf("Unexpected compressed frame: %v", frame)
+	}
+	if frame := readFrame(t, plain); frame["content"] != long {
+		t.Errorf("Unexpected uncompressed frame: %v", frame)
+	}
+
+	after := compressionStats(t, ts)
+	if after.Messages-before.Messages != 1 {
+		t.Errorf("Expected one compressed message, got %d", after.Messages-before.Messages)
+	}
+	if after.Skipped-before.Skipped != 1 {
+		t.Errorf("Expected one message below the threshold, got %d", after.Skipped-before.Skipped)
+	}
+	payload := after.PayloadBytes - before.PayloadBytes
+	wire := after.WireBytes - before.WireBytes
+	if payload <= uint64(len(long)) || wire == 0 || wire*4 > payload {
+		t.Errorf("Expected repetitive text to compress well, got %d bytes on the wire for %d", wire, payload)
+	}
+}
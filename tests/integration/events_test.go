@@ -0,0 +1,122 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/internal/config"
+	"chat/internal/server"
+)
+
+type sseEvent struct {
+	id    string
+	frame map[string]interface{}
+}
+
+func openEventStream(t *testing.T, url, lastEventID string) (*http.Response, <-chan sseEvent) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		var data strings.Builder
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				ev.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				data.WriteString(strings.TrimPrefix(line, "data: "))
+			case line == "" && data.Len() > 0:
+				json.Unmarshal([]byte(data.String()), &ev.frame)
+				events <- ev
+				ev = sseEvent{}
+				data.Reset()
+			}
+		}
+	}()
+	return resp, events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent, frameType string) sseEvent {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("Event stream closed while waiting for %s", frameType)
+			}
+			if ev.frame["type"] == frameType {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s event", frameType)
+		}
+	}
+}
+
+func TestServerSentEvents(t *testing.T) {
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"key"}}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	resp, events := openEventStream(t, ts.URL+"/events?rooms=sse", "")
+	session := nextEvent(t, events, "session").frame["data"].(map[string]interface{})["session"].(string)
+
+	frame := `{"type":"chat","room":"sse","content":"over http"}`
+	sendResp, err := http.Post(ts.URL+"/events/send?session="+session, "application/json", bytes.NewBufferString(frame))
+	if err != nil {
+		t.Fatalf("Failed to send frame: %v", err)
+	}
+	sendResp.Body.Close()
+	if sendResp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected status Accepted, got %v", sendResp.Status)
+	}
+
+	first := nextEvent(t, events, "chat")
+	if first.frame["content"] != "over http" || first.id != "sse:1" {
+		t.Fatalf("Unexpected first message: %+v", first)
+	}
+	resp.Body.Close()
+
+	for _, content := range []string{"missed one", "missed two"} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/room/sse/messages", bytes.NewBufferString(`{"content":"`+content+`"}`))
+		req.Header.Set("Authorization", "Bearer key")
+		postResp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to post message: %v", err)
+		}
+		postResp.Body.Close()
+	}
+
+	resp, events = openEventStream(t, ts.URL+"/events?rooms=sse", first.id)
+	defer resp.Body.Close()
+
+	for _, expected := range []string{"missed one", "missed two"} {
+		ev := nextEvent(t, events, "chat")
+		if ev.frame["content"] != expected {
+			t.Errorf("Expected replayed %q, got %v", expected, ev.frame)
+		}
+	}
+}
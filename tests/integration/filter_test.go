@@ -0,0 +1,55 @@
+package integration
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chat/internal/chat"
+	"chat/internal/config"
+	"chat/internal/filter"
+	"chat/internal/server"
+)
+
+func TestMessageFilters(t *testing.T) {
+	bannedWords, err := filter.NewBannedWords([]string{"darn", "/sp[a4]m/"})
+	if err != nil {
+		t.Fatalf("Failed to compile banned words: %v", err)
+	}
+	shadow := filter.Func(func(msg *chat.Message) filter.Verdict {
+		if strings.Contains(msg.Content, "buy now") {
+			return filter.DropMessage("advertising")
+		}
+		return filter.AllowMessage()
+	})
+
+	cfg := &config.Config{Address: ":8080"}
+	s := server.NewServer(cfg, server.WithMessageFilters(filter.MaxLength(20), bannedWords, shadow))
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	sender := dialWebSocket(t, ts)
+	receiver := dialWebSocket(t, ts)
+	joinAndWait(t, ts, sender, "filtered", 1)
+	joinAndWait(t, ts, receiver, "filtered", 2)
+
+	send := func(content string) {
+		sendFrame(t, sender, map[string]interface{}{"type": "chat", "room": "filtered", "content": content})
+	}
+
+	send("this message is far too long to pass")
+	if frame := readFrame(t, sender); frame["type"] != chat.EventError {
+		t.Errorf("Expected error frame, got %v", frame)
+	}
+
+	send("buy now")
+	if frame := readFrame(t, sender); frame["content"] != "buy now" {
+		t.Errorf("Expected dropped message to be echoed to sender, got %v", frame)
+	}
+
+	send("darn sp4m")
+	if frame := readFrame(t, receiver); frame["content"] != "**** ****" {
+		t.Errorf("Expected masked content, got %v", frame)
+	}
+}
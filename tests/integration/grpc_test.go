@@ -0,0 +1,261 @@
+package integration
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"chat/internal/chat"
+	"chat/internal/config"
+	"chat/internal/grpcapi"
+	"chat/internal/grpcapi/chatv1"
+	"chat/internal/server"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// serveGRPC starts the chat gRPC service for s and returns its address.
+func serveGRPC(t *testing.T, s *server.Server, opts ...grpc.ServerOption) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpcapi.NewServer(s, opts...)
+	go grpcServer.Serve(l)
+	t.Cleanup(grpcServer.Stop)
+	return l.Addr().String()
+}
+
+func dialGRPC(t *testing.T, addr string, opts ...grpc.DialOption) chatv1.ChatClient {
+	t.Helper()
+
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return chatv1.NewChatClient(conn)
+}
+
+func TestGRPCChat(t *testing.T) {
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"ci-key"}}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	client := dialGRPC(t, serveGRPC(t, s))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	authed := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer ci-key")
+
+	create := &chatv1.CreateRoomRequest{Room: &chatv1.RoomInfo{Id: "lobby", Title: "Lobby"}}
+	if _, err := client.CreateRoom(ctx, create); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without an API key, got %v", err)
+	}
+	info, err := client.CreateRoom(authed, create)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	if info.Title != "Lobby" || info.Visibility != chat.VisibilityPublic || info.CreatedAt == nil {
+		t.Errorf("Unexpected room info: %+v", info)
+	}
+	if _, err := client.CreateRoom(authed, &chatv1.CreateRoomRequest{Room: &chatv1.RoomInfo{Id: "lobby"}}); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("Expected AlreadyExists, got %v", err)
+	}
+
+	stream, err := client.Chat(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open chat stream: %v", err)
+	}
+	recv := func(frameType string) map[string]interface{} {
+		t.Helper()
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("Failed waiting for %s frame: %v", frameType, err)
+			}
+			var frame map[string]interface{}
+			if err := json.Unmarshal(msg.Frame, &frame); err != nil {
+				t.Fatalf("Invalid frame %s: %v", msg.Frame, err)
+			}
+			if frame["type"] == frameType {
+				return frame
+			}
+		}
+	}
+	send := func(frame string) {
+		t.Helper()
+		if err := stream.Send(&chatv1.ClientFrame{Frame: []byte(frame)}); err != nil {
+			t.Fatalf("Failed to send %s: %v", frame, err)
+		}
+	}
+
+	send(`{"type":"join","room":"lobby"}`)
+	recv("join")
+
+	ws := dialWebSocket(t, ts)
+	joinAndWait(t, ts, ws, "lobby", 2)
+
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "lobby", "content": "hello grpc"})
+	if frame := recv("chat"); frame["content"] != "hello grpc" || frame["sender"] != "guest-2" {
+		t.Errorf("Unexpected frame over gRPC: %v", frame)
+	}
+	readFrame(t, ws)
+
+	send(`{"type":"chat","room":"lobby","content":"hello websocket"}`)
+	if frame := readFrame(t, ws); frame["content"] != "hello websocket" || frame["sender"] != "guest-1" {
+		t.Errorf("Unexpected frame over WebSocket: %v", frame)
+	}
+
+	history, err := client.History(ctx, &chatv1.HistoryRequest{Room: "lobby", AfterSeq: 1})
+	if err != nil {
+		t.Fatalf("Failed to fetch history: %v", err)
+	}
+	if msgs := history.Messages; len(msgs) != 1 || msgs[0].Content != "hello websocket" || msgs[0].Seq != 2 || msgs[0].Timestamp == nil {
+		t.Errorf("Unexpected history: %+v", msgs)
+	}
+
+	summary, err := client.GetRoom(ctx, &chatv1.GetRoomRequest{Id: "lobby"})
+	if err != nil {
+		t.Fatalf("Failed to get room: %v", err)
+	}
+	if summary.Members != 2 || summary.Info.GetTitle() != "Lobby" {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+
+	page, err := client.ListRooms(ctx, &chatv1.ListRoomsRequest{Query: &chatv1.RoomQuery{Q: "lob"}})
+	if err != nil {
+		t.Fatalf("Failed to list rooms: %v", err)
+	}
+	if len(page.Rooms) != 1 || page.Rooms[0].Info.GetId() != "lobby" {
+		t.Errorf("Unexpected room page: %+v", page)
+	}
+	if _, err := client.ListRooms(ctx, &chatv1.ListRoomsRequest{Query: &chatv1.RoomQuery{Sort: "bogus"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+	private := &chatv1.ListRoomsRequest{Query: &chatv1.RoomQuery{Visibility: chat.VisibilityPrivate}}
+	if _, err := client.ListRooms(ctx, private); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated listing private rooms without an API key, got %v", err)
+	}
+	if _, err := client.ListRooms(authed, private); err != nil {
+		t.Errorf("Expected private rooms to be listed with an API key, got %v", err)
+	}
+
+	topic := "bridged"
+	update := &chatv1.UpdateRoomRequest{Id: "lobby", Update: &chatv1.RoomUpdate{Topic: &topic}}
+	if _, err := client.UpdateRoom(ctx, update); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without an API key, got %v", err)
+	}
+	if updated, err := client.UpdateRoom(authed, update); err != nil || updated.Topic != "bridged" || updated.Title != "Lobby" {
+		t.Errorf("Unexpected update: %+v, %v", updated, err)
+	}
+	recv(chat.EventRoomUpdated)
+	readFrame(t, ws)
+
+	if _, err := client.DeleteRoom(ctx, &chatv1.DeleteRoomRequest{Id: "lobby"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without an API key, got %v", err)
+	}
+	if _, err := client.DeleteRoom(authed, &chatv1.DeleteRoomRequest{Id: "lobby"}); err != nil {
+		t.Fatalf("Failed to delete room: %v", err)
+	}
+	recv(chat.EventRoomDeleted)
+	if frame := readFrame(t, ws); frame["type"] != chat.EventRoomDeleted {
+		t.Errorf("Expected room_deleted frame, got %v", frame)
+	}
+	if _, err := client.GetRoom(ctx, &chatv1.GetRoomRequest{Id: "lobby"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key,
+// returning their paths and a pool trusting the certificate.
+func writeTestCert(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "chat test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+
+	cert, _ := x509.ParseCertificate(der)
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func TestGRPCTLS(t *testing.T) {
+	certFile, keyFile, pool := writeTestCert(t)
+	cfg := config.Default()
+	cfg.GRPCTLSCertFile, cfg.GRPCTLSKeyFile = certFile, keyFile
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected the TLS settings to validate: %v", err)
+	}
+	s := server.NewServer(cfg)
+
+	creds, err := credentials.NewServerTLSFromFile(cfg.GRPCTLSCertFile, cfg.GRPCTLSKeyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	addr := serveGRPC(t, s, grpc.Creds(creds))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := dialGRPC(t, addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool})))
+	if _, err := client.ListRooms(ctx, &chatv1.ListRoomsRequest{}); err != nil {
+		t.Errorf("Expected a TLS client to be served, got %v", err)
+	}
+
+	plain := dialGRPC(t, addr)
+	if _, err := plain.ListRooms(ctx, &chatv1.ListRoomsRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected a plaintext client to be refused, got %v", err)
+	}
+}
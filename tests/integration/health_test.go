@@ -0,0 +1,204 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/internal/backplane"
+	"chat/internal/config"
+	"chat/internal/server"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type readyzResponse struct {
+	Status string `json:"status"`
+	Checks map[string]struct {
+		Status      string `json:"status"`
+		Error       string `json:"error"`
+		Connections int    `json:"connections"`
+	} `json:"checks"`
+}
+
+func getReadyz(t *testing.T, ts *httptest.Server) (int, readyzResponse) {
+	t.Helper()
+
+	resp, err := http.Get(ts.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("Failed to get readyz: %v", err)
+	}
+	defer resp.Body.Close()
+	var ready readyzResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ready); err != nil {
+		t.Fatalf("Failed to decode readyz: %v", err)
+	}
+	return resp.StatusCode, ready
+}
+
+func TestHealthz(t *testing.T) {
+	s := server.NewServer(&config.Config{Address: ":8080"})
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	s.Drain()
+	resp, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Failed to get healthz: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a draining server to be live, got %s", resp.Status)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	mr := miniredis.RunT(t)
+	bp := backplane.NewRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "")
+	defer bp.Close()
+
+	s := server.NewServer(&config.Config{Address: ":8080", MaxConnections: 2}, server.WithBackplane(bp))
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	status, ready := getReadyz(t, ts)
+	if status != http.StatusOK || ready.Status != "ok" {
+		t.Fatalf("Expected a fresh server to be ready, got %d %+v", status, ready)
+	}
+	for _, name := range []string{"drain", "store", "backplane", "connections"} {
+		if ready.Checks[name].Status != "ok" {
+			t.Errorf("Expected check %s to pass, got %+v", name, ready.Checks[name])
+		}
+	}
+
+	first := dialWebSocket(t, ts)
+	defer first.Close()
+	second := dialWebSocket(t, ts)
+	defer second.Close()
+	joinAndWait(t, ts, second, "lobby", 1)
+
+	status, ready = getReadyz(t, ts)
+	if check := ready.Checks["connections"]; status != http.StatusServiceUnavailable || check.Status != "fail" || check.Connections != 2 {
+		t.Errorf("Expected the connection ceiling to fail readiness, got %d %+v", status, check)
+	}
+	first.Close()
+	waitFor(t, "the connection to close", func() bool {
+		status, _ := getReadyz(t, ts)
+		return status == http.StatusOK
+	})
+
+	mr.Close()
+	status, ready = getReadyz(t, ts)
+	if check := ready.Checks["backplane"]; status != http.StatusServiceUnavailable || check.Status != "fail" || check.Error == "" {
+		t.Errorf("Expected an unreachable backplane to fail readiness, got %d %+v", status, check)
+	}
+	if ready.Checks["store"].Status != "ok" {
+		t.Errorf("Expected the in-memory store to stay ready, got %+v", ready.Checks["store"])
+	}
+}
+
+func TestReadyzDraining(t *testing.T) {
+	s := server.NewServer(&config.Config{Address: ":8080"})
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	conn := dialWebSocket(t, ts)
+	defer conn.Close()
+
+	s.Drain()
+	status, ready := getReadyz(t, ts)
+	if status != http.StatusServiceUnavailable || ready.Checks["drain"].Status != "fail" {
+		t.Errorf("Expected a draining server not to be ready, got %d %+v", status, ready)
+	}
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected new upgrades to be refused while draining, got %v", err)
+	}
+
+	joinAndWait(t, ts, conn, "lobby", 1)
+}
+
+func TestDrainRefusesNewSessions(t *testing.T) {
+	s := server.NewServer(&config.Config{Address: ":8080"})
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer tcp.Close()
+	go s.ServeTCP(tcp)
+
+	irc, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer irc.Close()
+	go s.ServeIRC(irc)
+
+	grpcAddr := serveGRPC(t, s)
+
+	existing := poll(t, ts.URL+"/poll?rooms=lobby")
+	before := scrapeMetrics(t, ts)
+	s.Drain()
+
+	for _, path := range []string{"/events?rooms=lobby", "/poll?rooms=lobby", "/ws"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to request %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected %s to be refused while draining, got %s", path, resp.Status)
+		}
+	}
+	if page := poll(t, ts.URL+"/poll?wait=0&session="+existing.Session); page.Session != existing.Session {
+		t.Errorf("Expected an existing poll session to keep working, got %+v", page)
+	}
+
+	for _, gateway := range []struct {
+		addr, reply string
+	}{
+		{tcp.Addr().String(), "ERR server is shutting down"},
+		{irc.Addr().String(), "ERROR :server is shutting down"},
+	} {
+		conn, err := net.Dial("tcp", gateway.addr)
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if strings.TrimSpace(line) != gateway.reply || err != nil {
+			t.Errorf("Expected %q, got %q (%v)", gateway.reply, line, err)
+		}
+		conn.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := dialGRPC(t, grpcAddr).Chat(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open chat stream: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected gRPC chat to be unavailable while draining, got %v", err)
+	}
+
+	after := scrapeMetrics(t, ts)
+	if name := "chat_websocket_upgrade_failures_total"; after[name] != before[name] {
+		t.Errorf("Expected refused upgrades not to count as failures, got %v then %v", before[name], after[name])
+	}
+}
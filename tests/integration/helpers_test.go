@@ -0,0 +1,83 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/internal/chat"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWebSocket(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial websocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func sendFrame(t *testing.T, conn *websocket.Conn, frame map[string]interface{}) {
+	t.Helper()
+
+	if err := conn.WriteJSON(frame); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+}
+
+// readFrame returns the next frame, skipping membership events.
+func readFrame(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+
+	for {
+		frame := readAnyFrame(t, conn)
+		if frame["type"] != chat.EventJoin && frame["type"] != chat.EventLeave {
+			return frame
+		}
+	}
+}
+
+func readAnyFrame(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var frame map[string]interface{}
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	return frame
+}
+
+func joinAndWait(t *testing.T, ts *httptest.Server, conn *websocket.Conn, room string, members int) {
+	t.Helper()
+
+	sendFrame(t, conn, map[string]interface{}{"type": "join", "room": room})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(ts.URL + "/rooms?q=" + room)
+		if err != nil {
+			t.Fatalf("Failed to get rooms: %v", err)
+		}
+		var page struct {
+			Rooms []chat.RoomSummary `json:"rooms"`
+		}
+		json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		for _, r := range page.Rooms {
+			if r.ID == room && r.Members >= members {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d members in room %s", members, room)
+}
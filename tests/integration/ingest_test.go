@@ -0,0 +1,96 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chat/internal/config"
+	"chat/internal/server"
+)
+
+func TestIncomingWebhook(t *testing.T) {
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"ci-key"}}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	http.Post(ts.URL+"/room/alerts", "", nil)
+	conn := dialWebSocket(t, ts)
+	joinAndWait(t, ts, conn, "alerts", 1)
+
+	resp, err := http.Post(ts.URL+"/room/alerts/token", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to rotate token: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected an unauthenticated rotation to be refused, got %v", resp.Status)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/room/alerts/token", nil)
+	req.Header.Set("Authorization", "Bearer ci-key")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to rotate token: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected token created, got %v", resp.Status)
+	}
+	var token struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&token)
+	resp.Body.Close()
+
+	post := func(auth, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/room/alerts/messages", bytes.NewBufferString(body))
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to post message: %v", err)
+		}
+		return resp
+	}
+
+	resp = post("wrong", `{"content":"nope"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status Unauthorized, got %v", resp.Status)
+	}
+
+	for _, auth := range []string{token.Token, "ci-key"} {
+		resp = post(auth, `{"content":"build failed","sender":"ci"}`)
+		var created struct {
+			ID string `json:"id"`
+		}
+		json.NewDecoder(resp.Body).Decode(&created)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated || created.ID == "" {
+			t.Fatalf("Expected created message, got %v", resp.Status)
+		}
+
+		frame := readFrame(t, conn)
+		if frame["id"] != created.ID || frame["sender"] != "ci" || frame["content"] != "build failed" || frame["bot"] != true {
+			t.Errorf("Unexpected frame: %v", frame)
+		}
+	}
+
+	// Senders follow the nick rules and cannot pose as a connected member.
+	for body, status := range map[string]int{
+		`{"content":"hi","sender":"ci bot"}`:    http.StatusBadRequest,
+		`{"content":"hi","sender":"ci\r\nbot"}`: http.StatusBadRequest,
+		`{"content":"hi","sender":"guest-1"}`:   http.StatusConflict,
+	} {
+		resp = post(token.Token, body)
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Expected %d for %s, got %v", status, body, resp.Status)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package integration
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/internal/config"
+	"chat/internal/server"
+)
+
+type ircTestClient struct {
+	t     *testing.T
+	conn  net.Conn
+	lines *bufio.Reader
+}
+
+func dialIRC(t *testing.T, addr string) *ircTestClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial IRC gateway: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &ircTestClient{t: t, conn: conn, lines: bufio.NewReader(conn)}
+}
+
+func (c *ircTestClient) send(format string, args ...interface{}) {
+	fmt.Fprintf(c.conn, format+"\r\n", args...)
+}
+
+func (c *ircTestClient) expect(substr string) string {
+	c.t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		line, err := c.lines.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("Failed waiting for %q: %v", substr, err)
+		}
+		if strings.Contains(line, substr) {
+			return strings.TrimSpace(line)
+		}
+	}
+}
+
+func TestIRCGateway(t *testing.T) {
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"ci-key"}}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	go s.ServeIRC(l)
+
+	irc := dialIRC(t, l.Addr().String())
+	irc.send("NICK carol")
+	irc.send("USER carol 0 * :Carol")
+	irc.expect(" 001 carol ")
+
+	ws := dialWebSocket(t, ts)
+	joinAndWait(t, ts, ws, "lobby", 1)
+
+	irc.send("JOIN #lobby")
+	irc.expect(":carol!carol@127.0.0.1 JOIN #lobby")
+	if names := irc.expect(" 353 carol = #lobby "); !strings.Contains(names, "carol") || !strings.Contains(names, "guest-2") {
+		t.Errorf("Unexpected NAMES reply: %q", names)
+	}
+	irc.expect(" 366 carol #lobby ")
+
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "lobby", "content": "hello irc"})
+	irc.expect(":guest-2!guest-2@chat PRIVMSG #lobby :hello irc")
+	readFrame(t, ws)
+
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "lobby", "content": "/me waves"})
+	irc.expect(":guest-2!guest-2@chat PRIVMSG #lobby :\x01ACTION waves\x01")
+	readFrame(t, ws)
+
+	irc.send("PRIVMSG #lobby :hello websocket")
+	if frame := readFrame(t, ws); frame["sender"] != "carol" || frame["content"] != "hello websocket" {
+		t.Errorf("Unexpected frame: %v", frame)
+	}
+
+	irc.send("TOPIC #lobby :bridged")
+	irc.expect("TOPIC #lobby :bridged")
+	if frame := readFrame(t, ws); frame["type"] != "room_updated" {
+		t.Errorf("Expected room update, got %v", frame)
+	}
+
+	// Updates that leave the topic alone are not shown as a TOPIC change.
+	resp := adminRequest(t, ts, http.MethodPatch, "/room/lobby", "ci-key", `{"title":"Lobby"}`)
+	resp.Body.Close()
+	readFrame(t, ws)
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "lobby", "content": "after the title"})
+	if line := irc.expect(" #lobby "); !strings.HasSuffix(line, "PRIVMSG #lobby :after the title") {
+		t.Errorf("Expected a title change to be silent, got %q", line)
+	}
+	readFrame(t, ws)
+
+	irc.send("PRIVMSG guest-2 :psst")
+	if frame := readFrame(t, ws); frame["type"] != "direct" {
+		t.Errorf("Expected direct message, got %v", frame)
+	}
+
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "lobby", "content": "one\r\nQUIT"})
+	irc.expect(":guest-2!guest-2@chat PRIVMSG #lobby :one QUIT")
+
+	irc.send("PING :token")
+	irc.expect("PONG " + "chat.gateway :token")
+}
@@ -0,0 +1,108 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"chat/internal/config"
+	"chat/internal/logging"
+	"chat/internal/server"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs routes the default logger into a buffer of JSON lines for the
+// rest of the test.
+func captureLogs(t *testing.T, opts logging.Options) *syncBuffer {
+	t.Helper()
+
+	var buf syncBuffer
+	opts.Format = logging.FormatJSON
+	logger, err := logging.New(&buf, opts)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func logRecords(t *testing.T, buf *syncBuffer, msg string) []map[string]interface{} {
+	t.Helper()
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to parse log line %q: %v", line, err)
+		}
+		if record["msg"] == msg {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestStructuredLogging(t *testing.T) {
+	for _, logContent := range []bool{false, true} {
+		buf := captureLogs(t, logging.Options{Level: slog.LevelDebug, LogContent: logContent})
+
+		s := server.NewServer(&config.Config{Address: ":8080"})
+		ts := httptest.NewServer(s.Router())
+
+		conn := dialWebSocket(t, ts)
+		joinAndWait(t, ts, conn, "lobby", 1)
+		sendFrame(t, conn, map[string]interface{}{"type": "chat", "room": "lobby", "content": "top secret"})
+		readFrame(t, conn)
+		conn.Close()
+		ts.Close()
+
+		records := logRecords(t, buf, "Received chat message")
+		if len(records) != 1 {
+			t.Fatalf("Expected one chat message record, got %d in %s", len(records), buf)
+		}
+		record := records[0]
+		for _, key := range []string{logging.KeyConn, logging.KeyUser, logging.KeyRoom, logging.KeyRemote} {
+			if value, _ := record[key].(string); value == "" {
+				t.Errorf("Expected %s on %v", key, record)
+			}
+		}
+		if record[logging.KeyRoom] != "lobby" {
+			t.Errorf("Expected room lobby, got %v", record[logging.KeyRoom])
+		}
+		if record["level"] != "DEBUG" {
+			t.Errorf("Expected message bodies at debug level, got %v", record["level"])
+		}
+
+		content, _ := record[logging.KeyContent].(string)
+		if logContent != strings.Contains(content, "top secret") {
+			t.Errorf("Unexpected content with LogContent=%v: %q", logContent, content)
+		}
+
+		opened := logRecords(t, buf, "Connection opened")
+		if len(opened) != 1 || opened[0][logging.KeyConn] != record[logging.KeyConn] {
+			t.Errorf("Expected the session to open under the same connection ID, got %v", opened)
+		}
+	}
+}
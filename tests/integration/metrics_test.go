@@ -0,0 +1,122 @@
+package integration
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"chat/internal/config"
+	"chat/internal/server"
+)
+
+// scrapeMetrics returns every sample on /metrics, keyed by its name and
+// labels exactly as they appear in the exposition.
+func scrapeMetrics(t *testing.T, ts *httptest.Server) map[string]float64 {
+	t.Helper()
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("Expected the text exposition format, got %q", resp.Header.Get("Content-Type"))
+	}
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("Failed to parse sample %q: %v", line, err)
+		}
+		samples[line[:i]] = value
+	}
+	return samples
+}
+
+func TestMetrics(t *testing.T) {
+	s := server.NewServer(&config.Config{Address: ":8080"})
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	before := scrapeMetrics(t, ts)
+
+	alice := dialWebSocket(t, ts)
+	defer alice.Close()
+	bob := dialWebSocket(t, ts)
+	defer bob.Close()
+	joinAndWait(t, ts, alice, "lobby", 1)
+	joinAndWait(t, ts, bob, "lobby", 2)
+
+	sendFrame(t, alice, map[string]interface{}{"type": "chat", "room": "lobby", "content": "hi"})
+	readFrame(t, alice)
+	readFrame(t, bob)
+	sendFrame(t, alice, map[string]interface{}{"type": "nick", "name": ""})
+	if frame := readAnyFrame(t, alice); frame["type"] != "error" {
+		t.Fatalf("Expected an error frame, got %v", frame)
+	}
+
+	resp, err := http.Get(ts.URL + "/ws")
+	if err != nil {
+		t.Fatalf("Failed to request /ws: %v", err)
+	}
+	resp.Body.Close()
+
+	after := scrapeMetrics(t, ts)
+	delta := func(name string) float64 {
+		return after[name] - before[name]
+	}
+
+	if got := after["chat_connections_active"]; got != 2 {
+		t.Errorf("Expected 2 active connections, got %v", got)
+	}
+	if got := after["chat_rooms"]; got != 1 {
+		t.Errorf("Expected 1 room, got %v", got)
+	}
+	if got := after[`chat_room_members_bucket{le="2"}`]; got != 1 {
+		t.Errorf("Expected the room in the two-member bucket, got %v", got)
+	}
+	if got := after[`chat_room_members_bucket{le="1"}`]; got != 0 {
+		t.Errorf("Expected no room with a single member, got %v", got)
+	}
+	if got := delta(`chat_messages_received_total{type="join"}`); got != 2 {
+		t.Errorf("Expected 2 join frames received, got %v", got)
+	}
+	if got := delta(`chat_messages_received_total{type="chat"}`); got != 1 {
+		t.Errorf("Expected 1 chat frame received, got %v", got)
+	}
+	if got := delta(`chat_messages_sent_total{type="chat"}`); got != 2 {
+		t.Errorf("Expected the chat frame sent to 2 members, got %v", got)
+	}
+	if got := delta("chat_error_frames_sent_total"); got != 1 {
+		t.Errorf("Expected 1 error frame, got %v", got)
+	}
+	if got := delta("chat_websocket_upgrade_failures_total"); got != 1 {
+		t.Errorf("Expected 1 upgrade failure, got %v", got)
+	}
+	if got := delta("chat_broadcast_fanout_seconds_count"); got < 3 {
+		t.Errorf("Expected the joins and the chat message to be broadcast, got %v", got)
+	}
+	if got := delta("chat_send_queue_depth_count"); got < 3 {
+		t.Errorf("Expected queue depth samples, got %v", got)
+	}
+
+	// Process internals, the command line included, are not published.
+	resp, err = http.Get(ts.URL + "/debug/vars")
+	if err != nil {
+		t.Fatalf("Failed to request /debug/vars: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected /debug/vars not to be served, got %v", resp.Status)
+	}
+}
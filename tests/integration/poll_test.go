@@ -0,0 +1,93 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chat/internal/config"
+	"chat/internal/server"
+)
+
+type pollPage struct {
+	Session string                   `json:"session"`
+	Frames  []map[string]interface{} `json:"frames"`
+}
+
+func poll(t *testing.T, url string) pollPage {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", resp.Status)
+	}
+	var page pollPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode poll response: %v", err)
+	}
+	return page
+}
+
+func TestLongPolling(t *testing.T) {
+	cfg := &config.Config{Address: ":8080"}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	reader := poll(t, ts.URL+"/poll?rooms=legacy").Session
+	writer := poll(t, ts.URL+"/poll").Session
+	if reader == "" || writer == "" || reader == writer {
+		t.Fatalf("Expected two distinct sessions, got %q and %q", reader, writer)
+	}
+
+	for _, frame := range []string{
+		`{"type":"join","room":"legacy"}`,
+		`{"type":"chat","room":"legacy","content":"first"}`,
+		`{"type":"chat","room":"legacy","content":"second"}`,
+	} {
+		resp, err := http.Post(ts.URL+"/send?session="+writer, "application/json", bytes.NewBufferString(frame))
+		if err != nil {
+			t.Fatalf("Failed to send frame: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	var contents []string
+	for len(contents) < 2 {
+		page := poll(t, ts.URL+"/poll?wait=2&session="+reader)
+		if len(page.Frames) == 0 {
+			t.Fatalf("Timed out waiting for frames")
+		}
+		for _, frame := range page.Frames {
+			if frame["type"] == "chat" {
+				contents = append(contents, frame["content"].(string))
+			}
+		}
+	}
+	if contents[0] != "first" || contents[1] != "second" {
+		t.Errorf("Unexpected messages: %v", contents)
+	}
+}
+
+func TestLongPollOutlivesSessionTTL(t *testing.T) {
+	cfg := &config.Config{Address: ":8080", PollSessionTTL: time.Millisecond}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	session := poll(t, ts.URL+"/poll?rooms=lobby").Session
+	poll(t, ts.URL+"/poll?wait=0&session="+session)
+
+	// The reaper runs while the poll is waiting; a session in a poll is not
+	// idle, however short its TTL.
+	poll(t, ts.URL+"/poll?wait=6&session="+session)
+}
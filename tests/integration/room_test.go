@@ -0,0 +1,160 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"chat/internal/chat"
+	"chat/internal/config"
+	"chat/internal/server"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRoomMetadata(t *testing.T) {
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"ci-key"}}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	body := `{"title":"Ops","topic":"deploys","created_by":"alice","attributes":{"team":"sre"}}`
+	resp, err := http.Post(ts.URL+"/room/ops", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v", resp.Status)
+	}
+
+	update := `{"topic":"incidents","attributes":{"team":""}}`
+	resp = adminRequest(t, ts, http.MethodPatch, "/room/ops", "", update)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected an unauthenticated update to be refused, got %v", resp.Status)
+	}
+
+	resp = adminRequest(t, ts, http.MethodPatch, "/room/ops", "ci-key", update)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", resp.Status)
+	}
+
+	var info chat.RoomInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if info.Title != "Ops" || info.Topic != "incidents" || info.CreatedBy != "alice" {
+		t.Errorf("Unexpected room info: %+v", info)
+	}
+	if _, ok := info.Attributes["team"]; ok {
+		t.Errorf("Expected attribute to be removed, got %v", info.Attributes)
+	}
+	if info.CreatedAt.IsZero() {
+		t.Errorf("Expected creation time to be set")
+	}
+}
+
+func TestDeleteRoom(t *testing.T) {
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"ci-key"}}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	ws := dialWebSocket(t, ts)
+	joinAndWait(t, ts, ws, "scratch", 1)
+
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "scratch", "content": "before"})
+	readFrame(t, ws)
+	resp := adminRequest(t, ts, http.MethodPost, "/room/scratch/webhooks", "ci-key", `{"url":"http://example.com/hook"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected the webhook to be created, got %v", resp.Status)
+	}
+
+	resp = adminRequest(t, ts, http.MethodDelete, "/room/scratch", "", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected an unauthenticated delete to be refused, got %v", resp.Status)
+	}
+
+	resp = adminRequest(t, ts, http.MethodDelete, "/room/scratch", "ci-key", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", resp.StatusCode)
+	}
+
+	if frame := readFrame(t, ws); frame["type"] != chat.EventRoomDeleted {
+		t.Errorf("Expected room_deleted frame, got %v", frame)
+	}
+
+	resp = adminRequest(t, ts, http.MethodDelete, "/room/scratch", "ci-key", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+
+	sendFrame(t, ws, map[string]interface{}{"type": "join", "room": "scratch"})
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "scratch", "content": "still here"})
+	if frame := readFrame(t, ws); frame["content"] != "still here" {
+		t.Errorf("Expected connection to survive room deletion, got %v", frame)
+	} else if frame["seq"] != float64(1) {
+		t.Errorf("Expected the recreated room to number from 1, got %v", frame["seq"])
+	}
+
+	// The recreated room shares nothing with the deleted one.
+	history, err := s.History(context.Background(), "scratch", 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(history) != 1 || history[0].Content != "still here" {
+		t.Errorf("Expected only the new room's history, got %+v", history)
+	}
+
+	resp = adminRequest(t, ts, http.MethodGet, "/room/scratch/webhooks", "ci-key", "")
+	var subs []json.RawMessage
+	json.NewDecoder(resp.Body).Decode(&subs)
+	resp.Body.Close()
+	if len(subs) != 0 {
+		t.Errorf("Expected the deleted room's webhooks to be removed, got %d", len(subs))
+	}
+}
+
+func TestDeleteRoomDuringJoins(t *testing.T) {
+	cfg := &config.Config{Address: ":8080"}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	clients := make([]*websocket.Conn, 6)
+	for i := range clients {
+		clients[i] = dialWebSocket(t, ts)
+	}
+
+	// Joins racing a deletion must end up in a live room, never in the
+	// deleted one.
+	var wg sync.WaitGroup
+	for round := 0; round < 200; round++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.DeleteRoom("churn")
+		}()
+		for _, ws := range clients {
+			sendFrame(t, ws, map[string]interface{}{"type": "join", "room": "churn"})
+		}
+	}
+	wg.Wait()
+	for i, ws := range clients {
+		joinAndWait(t, ts, ws, "churn", i+1)
+	}
+	joinAndWait(t, ts, clients[0], "churn", len(clients))
+}
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"chat/internal/chat"
 	"chat/internal/config"
 	"chat/internal/server"
 )
@@ -32,12 +33,120 @@ func TestListRooms(t *testing.T) {
 		t.Errorf("Expected status OK; got %v", resp.Status)
 	}
 
-	var rooms []string
-	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+	var page struct {
+		Rooms []chat.RoomSummary `json:"rooms"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
-	if len(rooms) != 1 || rooms[0] != "testroom" {
-		t.Errorf("Unexpected rooms list: %v", rooms)
+	if len(page.Rooms) != 1 || page.Rooms[0].ID != "testroom" {
+		t.Errorf("Unexpected rooms list: %v", page.Rooms)
+	}
+}
+
+func TestListRoomsPagination(t *testing.T) {
+	cfg := &config.Config{Address: ":8080"}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	for _, name := range []string{"alpha", "beta", "gamma", "delta", "other"} {
+		if _, err := http.Post(ts.URL+"/room/"+name, "", nil); err != nil {
+			t.Fatalf("Failed to create room: %v", err)
+		}
+	}
+
+	var seen []string
+	cursor := ""
+	for {
+		resp, err := http.Get(ts.URL + "/rooms?q=a&sort=name&limit=2&cursor=" + cursor)
+		if err != nil {
+			t.Fatalf("Failed to get rooms: %v", err)
+		}
+		var page struct {
+			Rooms      []chat.RoomSummary `json:"rooms"`
+			NextCursor string             `json:"next_cursor"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		for _, room := range page.Rooms {
+			seen = append(seen, room.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	expected := []string{"alpha", "beta", "delta", "gamma"}
+	if len(seen) != len(expected) {
+		t.Fatalf("Unexpected rooms list: %v", seen)
+	}
+	for i := range expected {
+		if seen[i] != expected[i] {
+			t.Errorf("Unexpected rooms list: %v", seen)
+			break
+		}
+	}
+}
+
+func TestListRoomsVisibility(t *testing.T) {
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"ci-key"}}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	for path, body := range map[string]string{
+		"/room/lobby":  `{"title":"Zebra crossing"}`,
+		"/room/secret": `{"title":"Alpha team","visibility":"private"}`,
+		"/room/misc":   `{}`,
+	} {
+		resp := adminRequest(t, ts, http.MethodPost, path, "", body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Failed to create %s: %v", path, resp.Status)
+		}
+	}
+
+	list := func(query, key string) []string {
+		t.Helper()
+		resp := adminRequest(t, ts, http.MethodGet, "/rooms"+query, key, "")
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status OK for %q, got %v", query, resp.Status)
+		}
+		var page struct {
+			Rooms []chat.RoomSummary `json:"rooms"`
+		}
+		json.NewDecoder(resp.Body).Decode(&page)
+		var ids []string
+		for _, room := range page.Rooms {
+			ids = append(ids, room.ID)
+		}
+		return ids
+	}
+
+	// Rooms are sorted by title, falling back to the ID.
+	if ids := list("", ""); len(ids) != 2 || ids[0] != "misc" || ids[1] != "lobby" {
+		t.Errorf("Expected public rooms by title by default, got %v", ids)
+	}
+	for _, query := range []string{"?visibility=private", "?visibility=all"} {
+		resp := adminRequest(t, ts, http.MethodGet, "/rooms"+query, "", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected %s to require an API key, got %v", query, resp.Status)
+		}
+	}
+	if ids := list("?visibility=private", "ci-key"); len(ids) != 1 || ids[0] != "secret" {
+		t.Errorf("Expected the private room, got %v", ids)
+	}
+	if ids := list("?visibility=all&sort=name", "ci-key"); len(ids) != 3 || ids[0] != "secret" || ids[1] != "misc" || ids[2] != "lobby" {
+		t.Errorf("Expected every room by title, got %v", ids)
 	}
 }
@@ -0,0 +1,104 @@
+package integration
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chat/internal/config"
+	"chat/internal/server"
+)
+
+func TestTCPGateway(t *testing.T) {
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"ci-key"}}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	go s.ServeTCP(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	lines := bufio.NewReader(conn)
+	readUntil := func(substr string) string {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			line, err := lines.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed waiting for %q: %v", substr, err)
+			}
+			if strings.Contains(line, substr) {
+				return strings.TrimSpace(line)
+			}
+		}
+	}
+
+	fmt.Fprint(conn, "NICK ops\r\nJOIN lobby\r\n")
+	readUntil("* ops joined")
+
+	ws := dialWebSocket(t, ts)
+	joinAndWait(t, ts, ws, "lobby", 2)
+
+	fmt.Fprint(conn, "MSG lobby hello from netcat\r\n")
+	if frame := readFrame(t, ws); frame["sender"] != "ops" || frame["content"] != "hello from netcat" {
+		t.Errorf("Unexpected frame: %v", frame)
+	}
+
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "lobby", "content": "hi ops"})
+	if line := readUntil("hi ops"); !strings.HasPrefix(line, "[lobby] guest-") {
+		t.Errorf("Unexpected line: %q", line)
+	}
+
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "lobby", "content": "/me waves"})
+	if line := readUntil("waves"); !strings.HasPrefix(line, "[lobby] * guest-") || !strings.HasSuffix(line, " waves") {
+		t.Errorf("Unexpected action line: %q", line)
+	}
+
+	// Only updates that set the topic are shown.
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "lobby", "content": "/topic bridged"})
+	readUntil("* topic: bridged")
+	resp := adminRequest(t, ts, http.MethodPatch, "/room/lobby", "ci-key", `{"title":"Lobby"}`)
+	resp.Body.Close()
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "lobby", "content": "after the title"})
+	if line := readUntil("[lobby]"); !strings.HasSuffix(line, ": after the title") {
+		t.Errorf("Expected a title change to be silent, got %q", line)
+	}
+
+	fmt.Fprint(conn, "BOGUS\r\n")
+	readUntil("ERR unknown command BOGUS")
+
+	sendFrame(t, ws, map[string]interface{}{"type": "chat", "room": "lobby", "content": "one\r\nBYE\ntwo"})
+	if line := readUntil("one"); !strings.HasSuffix(line, ": one BYE two") {
+		t.Errorf("Expected line breaks to be flattened, got %q", line)
+	}
+
+	// Take the next guest name as a nickname; the next client must not get it.
+	sendFrame(t, ws, map[string]interface{}{"type": "nick", "name": "guest-3"})
+	readUntil("is now known as guest-3")
+	next, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer next.Close()
+	next.SetReadDeadline(time.Now().Add(2 * time.Second))
+	greeting := bufio.NewReader(next)
+	greeting.ReadString('\n')
+	if line, _ := greeting.ReadString('\n'); strings.TrimSpace(line) != "You are guest-4" {
+		t.Errorf("Expected the next free guest name, got %q", line)
+	}
+}
@@ -0,0 +1,132 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"chat/internal/config"
+	"chat/internal/server"
+	"chat/internal/webhook"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	spanExporter     = tracetest.NewInMemoryExporter()
+	spanExporterOnce sync.Once
+)
+
+// recordSpans installs an in-memory tracer provider. Tracers bind to the
+// first global provider, so it is installed once and only reset per test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	spanExporterOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spanExporter)))
+	})
+	spanExporter.Reset()
+	t.Cleanup(spanExporter.Reset)
+	return spanExporter
+}
+
+func TestTracing(t *testing.T) {
+	exporter := recordSpans(t)
+
+	webhookTrace := make(chan string, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookTrace <- r.Header.Get("traceparent")
+	}))
+	defer receiver.Close()
+
+	s := server.NewServer(&config.Config{Address: ":8080", APIKeys: []string{"ci-key"}})
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	http.Post(ts.URL+"/room/lobby", "", nil)
+	body := `{"url":"` + receiver.URL + `","events":["` + webhook.EventMessage + `"]}`
+	resp := adminRequest(t, ts, http.MethodPost, "/room/lobby/webhooks", "ci-key", body)
+	resp.Body.Close()
+
+	alice := dialWebSocket(t, ts)
+	defer alice.Close()
+	bob := dialWebSocket(t, ts)
+	defer bob.Close()
+	joinAndWait(t, ts, alice, "lobby", 1)
+	joinAndWait(t, ts, bob, "lobby", 2)
+
+	const clientTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const clientSpanID = "00f067aa0ba902b7"
+	sendFrame(t, alice, map[string]interface{}{
+		"type":        "chat",
+		"room":        "lobby",
+		"content":     "traced",
+		"traceparent": "00-" + clientTraceID + "-" + clientSpanID + "-01",
+	})
+	readFrame(t, alice)
+	if frame := readFrame(t, bob); frame["content"] != "traced" {
+		t.Fatalf("Unexpected frame: %v", frame)
+	}
+
+	// The client's trace is linked from chat.receive, which starts the
+	// server's own trace: clients do not decide what the server samples.
+	var traceID string
+	waitFor(t, "chat.receive", func() bool {
+		for _, span := range exporter.GetSpans() {
+			if span.Name != "chat.receive" || len(span.Links) != 1 {
+				continue
+			}
+			link := span.Links[0].SpanContext
+			if link.TraceID().String() == clientTraceID && link.SpanID().String() == clientSpanID {
+				traceID = span.SpanContext.TraceID().String()
+				if span.Parent.IsValid() {
+					t.Errorf("Expected chat.receive to start a trace, got parent %s", span.Parent.SpanID())
+				}
+				return true
+			}
+		}
+		return false
+	})
+
+	if traceparent := <-webhookTrace; !strings.Contains(traceparent, traceID) {
+		t.Errorf("Expected the webhook delivery to continue trace %s, got %q", traceID, traceparent)
+	}
+
+	want := map[string]int{
+		"chat.receive":    1,
+		"chat.filter":     1,
+		"room.publish":    1,
+		"chat.persist":    1,
+		"room.broadcast":  1,
+		"room.fanout":     1,
+		"chat.deliver":    2,
+		"webhook.deliver": 1,
+	}
+	counts := func() map[string]int {
+		counts := make(map[string]int)
+		for _, span := range exporter.GetSpans() {
+			if span.SpanContext.TraceID().String() == traceID {
+				counts[span.Name]++
+			}
+		}
+		return counts
+	}
+	waitFor(t, "spans", func() bool {
+		got := counts()
+		for name, n := range want {
+			if got[name] != n {
+				return false
+			}
+		}
+		return true
+	})
+	for _, span := range exporter.GetSpans() {
+		if span.SpanContext.TraceID().String() == clientTraceID {
+			t.Errorf("Expected no span in the client's trace, got %s", span.Name)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chat/internal/config"
+	"chat/internal/server"
+	"chat/internal/webhook"
+)
+
+func TestOutgoingWebhooks(t *testing.T) {
+	var attempts int32
+	received := make(chan webhook.Event, 1)
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if !webhook.Verify(secret, timestamp, body, r.Header.Get(webhook.HeaderSignature)) {
+			t.Errorf("Invalid webhook signature")
+		}
+		var ev webhook.Event
+		json.Unmarshal(body, &ev)
+		received <- ev
+	}))
+	defer receiver.Close()
+
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"ci-key"}, WebhookBackoff: 10 * time.Millisecond}
+	s := server.NewServer(cfg)
+
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	http.Post(ts.URL+"/room/hooks", "", nil)
+
+	body := `{"url":"` + receiver.URL + `","events":["room.updated"]}`
+	for _, path := range []string{"/room/hooks/webhooks", "/room/hooks/webhooks/dead"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected %s to require an API key, got %v", path, resp.Status)
+		}
+	}
+	resp, err := http.Post(ts.URL+"/room/hooks/webhooks", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Failed to register webhook: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected an unauthenticated webhook to be refused, got %v", resp.Status)
+	}
+
+	resp = adminRequest(t, ts, http.MethodPost, "/room/hooks/webhooks", "ci-key", body)
+	var sub webhook.Subscription
+	json.NewDecoder(resp.Body).Decode(&sub)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || sub.Secret == "" {
+		t.Fatalf("Expected created subscription with a secret, got %v %+v", resp.Status, sub)
+	}
+	secret = sub.Secret
+
+	resp = adminRequest(t, ts, http.MethodPatch, "/room/hooks", "ci-key", `{"topic":"hooked"}`)
+	resp.Body.Close()
+
+	select {
+	case ev := <-received:
+		if ev.Type != webhook.EventRoomUpdated || ev.Room != "hooks" {
+			t.Errorf("Unexpected webhook event: %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for webhook delivery")
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("Expected 2 delivery attempts, got %d", n)
+	}
+
+	resp = adminRequest(t, ts, http.MethodDelete, "/room/hooks/webhooks/"+sub.ID, "", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected an unauthenticated delete to be refused, got %v", resp.Status)
+	}
+	resp = adminRequest(t, ts, http.MethodDelete, "/room/hooks/webhooks/"+sub.ID, "ci-key", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status No Content, got %v", resp.Status)
+	}
+}
+
+func TestWebhookDirQueue(t *testing.T) {
+	if _, err := webhook.NewDirQueue(t.TempDir(), ""); !errors.Is(err, webhook.ErrNoQueueKey) {
+		t.Fatalf("Expected ErrNoQueueKey, got %v", err)
+	}
+
+	dir := t.TempDir()
+	queue, err := webhook.NewDirQueue(dir, "queue-key")
+	if err != nil {
+		t.Fatalf("Failed to open queue: %v", err)
+	}
+	delivery := &webhook.Delivery{ID: "d1", Room: "hooks", URL: "http://example.com", Secret: "subscription-secret"}
+	if err := queue.Put(delivery); err != nil {
+		t.Fatalf("Failed to queue delivery: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "pending", "d1.json"))
+	if err != nil {
+		t.Fatalf("Failed to read queued delivery: %v", err)
+	}
+	if bytes.Contains(data, []byte("subscription-secret")) {
+		t.Errorf("Expected the secret to be sealed, got %s", data)
+	}
+
+	// The queue survives a restart with the same key, but not another one.
+	reopened, _ := webhook.NewDirQueue(dir, "queue-key")
+	pending, err := reopened.Pending()
+	if err != nil || len(pending) != 1 || pending[0].Secret != "subscription-secret" {
+		t.Errorf("Expected the delivery back with its secret, got %+v (%v)", pending, err)
+	}
+	other, _ := webhook.NewDirQueue(dir, "other-key")
+	if pending, _ := other.Pending(); len(pending) != 0 {
+		t.Errorf("Expected deliveries sealed with another key to be skipped, got %+v", pending)
+	}
+}
+
+func TestWebhookSubscriptionsSurviveRestart(t *testing.T) {
+	var secret atomic.Value
+	received := make(chan webhook.Event, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if !webhook.Verify(secret.Load().(string), timestamp, body, r.Header.Get(webhook.HeaderSignature)) {
+			t.Errorf("Invalid webhook signature")
+		}
+		var ev webhook.Event
+		json.Unmarshal(body, &ev)
+		received <- ev
+	}))
+	defer receiver.Close()
+
+	dir := t.TempDir()
+	cfg := &config.Config{Address: ":8080", APIKeys: []string{"ci-key"}}
+	start := func() (*server.Server, *httptest.Server) {
+		queue, err := webhook.NewDirQueue(dir, "queue-key")
+		if err != nil {
+			t.Fatalf("Failed to open queue: %v", err)
+		}
+		s := server.NewServer(cfg, server.WithWebhookQueue(queue))
+		ts := httptest.NewServer(s.Router())
+		http.Post(ts.URL+"/room/hooks", "", nil)
+		return s, ts
+	}
+
+	s, ts := start()
+	resp := adminRequest(t, ts, http.MethodPost, "/room/hooks/webhooks", "ci-key", `{"url":"`+receiver.URL+`","events":["message"]}`)
+	var sub webhook.Subscription
+	json.NewDecoder(resp.Body).Decode(&sub)
+	resp.Body.Close()
+	secret.Store(sub.Secret)
+
+	data, err := os.ReadFile(filepath.Join(dir, "subscriptions", sub.ID+".json"))
+	if err != nil {
+		t.Fatalf("Expected the subscription to be saved: %v", err)
+	}
+	if bytes.Contains(data, []byte(sub.Secret)) {
+		t.Errorf("Expected the secret to be sealed, got %s", data)
+	}
+	ts.Close()
+	s.Close()
+
+	s, ts = start()
+	defer s.Close()
+	defer ts.Close()
+
+	conn := dialWebSocket(t, ts)
+	joinAndWait(t, ts, conn, "hooks", 1)
+	sendFrame(t, conn, map[string]interface{}{"type": "chat", "room": "hooks", "content": "after restart"})
+	select {
+	case ev := <-received:
+		if ev.Type != webhook.EventMessage || ev.Room != "hooks" {
+			t.Errorf("Unexpected webhook event: %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for a delivery after the restart")
+	}
+
+	resp = adminRequest(t, ts, http.MethodDelete, "/room/hooks/webhooks/"+sub.ID, "ci-key", "")
+	resp.Body.Close()
+	if _, err := os.Stat(filepath.Join(dir, "subscriptions", sub.ID+".json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the subscription file to be removed, got %v", err)
+	}
+}
+
+// countingQueue counts how often the dispatcher reads the whole queue.
+type countingQueue struct {
+	*webhook.MemoryQueue
+	reads atomic.Int32
+}
+
+func (q *countingQueue) Pending() ([]*webhook.Delivery, error) {
+	q.reads.Add(1)
+	return q.MemoryQueue.Pending()
+}
+
+func TestWebhookQueueReadOnce(t *testing.T) {
+	var delivered atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered.Add(1)
+	}))
+	defer receiver.Close()
+
+	queue := &countingQueue{MemoryQueue: webhook.NewMemoryQueue()}
+	s := server.NewServer(&config.Config{Address: ":8080", APIKeys: []string{"ci-key"}}, server.WithWebhookQueue(queue))
+	defer s.Close()
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	http.Post(ts.URL+"/room/hooks", "", nil)
+	resp := adminRequest(t, ts, http.MethodPost, "/room/hooks/webhooks", "ci-key", `{"url":"`+receiver.URL+`","events":["message"]}`)
+	resp.Body.Close()
+
+	conn := dialWebSocket(t, ts)
+	joinAndWait(t, ts, conn, "hooks", 1)
+	for i := 0; i < 20; i++ {
+		sendFrame(t, conn, map[string]interface{}{"type": "chat", "room": "hooks", "content": "backlog"})
+	}
+	waitFor(t, "every message to be delivered", func() bool { return delivered.Load() == 20 })
+	if reads := queue.reads.Load(); reads != 1 {
+		t.Errorf("Expected the queue to be read once at start, got %d reads", reads)
+	}
+}
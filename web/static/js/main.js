@@ -86,6 +86,10 @@ socket.onmessage = function(event) {
     const message = JSON.parse(event.data);
     if (message.type === 'chat') {
         displayMessage(message);
+    } else if (message.type === 'system') {
+        displayMessage({room: message.room, sender: '*', content: message.data.content});
+    } else if (message.type === 'action') {
+        displayMessage({room: message.room, sender: '*', content: message.data.sender + ' ' + message.data.content});
     } else if (message.type === 'join' || message.type === 'leave') {
         console.log(message.type + ' event for room: ' + message.room);
     }
@@ -94,6 +98,6 @@ socket.onmessage = function(event) {
 
 fetch('/rooms')
     .then(response => response.json())
-    .then(rooms => {
-        rooms.forEach(addRoomToList);
+    .then(page => {
+        page.rooms.forEach(room => addRoomToList(room.id));
     });
\ No newline at end of file